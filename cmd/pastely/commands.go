@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"al.imran.pastely/internal/paste"
+	"al.imran.pastely/pkg/client"
+)
+
+// newFlagSet returns a flag set for a command that prints its usage line
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pastely %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the flags of a command and checks the number of the
+// remaining arguments
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) error {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return errUsage
+	}
+	if err != nil {
+		return errUsage
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// parseID parses the id of a snippet
+func parseID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid snippet id %q", s)
+	}
+	return id, nil
+}
+
+// parseExpiry turns e.g. 7d, 1w or 1y into a number of days
+func parseExpiry(s string) (int, error) {
+	days, err := paste.ParseDays(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expiry %q, use e.g. 1d, 7d or 1y", s)
+	}
+	return days, nil
+}
+
+// printJSON writes v as indented JSON to stdout
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+// pastely create [-t title] [-e expiry] < file
+func runCreate(ctx context.Context, cfg *config, args []string) error {
+	fs := newFlagSet("create", "< file")
+	title := fs.String("t", "", "title of the snippet, the first line of the content by default")
+	expires := fs.String("e", "1y", "time until the snippet expires: 1d, 7d or 1y")
+	confirm := fs.Bool("y", false, "publish the snippet even if it looks like it contains secrets")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	days, err := parseExpiry(*expires)
+	if err != nil {
+		return err
+	}
+
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		return errors.New("nothing to paste, stdin is empty")
+	}
+
+	if *title == "" {
+		*title = paste.DefaultTitle(string(content))
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	snippet, err := c.CreateSnippet(ctx, client.NewSnippet{
+		Title:          *title,
+		Content:        string(content),
+		Expires:        days,
+		ConfirmSecrets: *confirm,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(snippet.URL)
+	return nil
+}
+
+// pastely get [-json] ID
+func runGet(ctx context.Context, cfg *config, args []string) error {
+	fs := newFlagSet("get", "ID")
+	asJSON := fs.Bool("json", false, "print the snippet as JSON")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	id, err := parseID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	snippet, err := c.GetSnippet(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(snippet)
+	}
+	_, err = io.WriteString(os.Stdout, snippet.Content)
+	return err
+}
+
+// pastely list [-mine] [-n count] [-page page] [-json]
+func runList(ctx context.Context, cfg *config, args []string) error {
+	fs := newFlagSet("list", "")
+	mine := fs.Bool("mine", false, "only list your own snippets")
+	count := fs.Int("n", 20, "number of snippets to list, at most 100")
+	page := fs.Int("page", 1, "page of snippets to list")
+	asJSON := fs.Bool("json", false, "print the snippets as JSON")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	snippets, err := c.ListSnippets(ctx, client.ListOptions{Page: *page, PageSize: *count, Mine: *mine})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(snippets)
+	}
+
+	// one line per snippet: id, expiry, title and URL
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, s := range snippets {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.ID, s.Expires.Format(time.DateOnly), s.Title, s.URL)
+	}
+	return tw.Flush()
+}
+
+// pastely delete ID
+func runDelete(ctx context.Context, cfg *config, args []string) error {
+	fs := newFlagSet("delete", "ID")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	id, err := parseID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	return c.DeleteSnippet(ctx, id)
+}
+
+// pastely login [-server URL] [-email EMAIL] [-password-stdin] [-token TOKEN]
+func runLogin(ctx context.Context, cfg *config, args []string) error {
+	fs := newFlagSet("login", "")
+	server := fs.String("server", cfg.Server, "URL of the Pastely server")
+	email := fs.String("email", "", "email address of your account")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from stdin")
+	token := fs.String("token", "", "store this access token instead of logging in with a password")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	var err error
+
+	if *server == "" {
+		*server, err = prompt(in, "Server URL: ")
+		if err != nil {
+			return err
+		}
+	}
+	cfg.Server = strings.TrimSuffix(*server, "/")
+
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	if *token == "" {
+		if *email == "" {
+			*email, err = prompt(in, "Email: ")
+			if err != nil {
+				return err
+			}
+		}
+
+		var password string
+		if *passwordStdin {
+			password, err = in.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			password = strings.TrimRight(password, "\r\n")
+		} else {
+			password, err = promptPassword(in, "Password: ")
+			if err != nil {
+				return err
+			}
+		}
+
+		hostname, _ := os.Hostname()
+		created, err := c.CreateToken(ctx, client.NewToken{
+			Email:    *email,
+			Password: password,
+			Name:     "pastely CLI on " + hostname,
+			Scopes:   []string{client.ScopeSnippetsRead, client.ScopeSnippetsWrite, client.ScopeSnippetsDelete},
+		})
+		if err != nil {
+			if errors.Is(err, client.ErrInvalidCredential) {
+				return errors.New("invalid email or password")
+			}
+			return err
+		}
+		*token = created.Token
+	}
+
+	// make sure the token works before storing it
+	c.Token = *token
+	user, err := c.CurrentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	cfg.Token = *token
+	err = cfg.save()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Logged in to %s as %s\n", cfg.Server, user.Email)
+	return nil
+}
+
+// prompt asks for a line of input on stderr, so stdout stays clean
+func prompt(in *bufio.Reader, question string) (string, error) {
+	fmt.Fprint(os.Stderr, question)
+	answer, err := in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && answer != "") {
+		return "", err
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// promptPassword is prompt without echoing the input, if stty can turn
+// echoing off
+func promptPassword(in *bufio.Reader, question string) (string, error) {
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	fmt.Fprint(os.Stderr, question)
+	answer, err := in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && answer != "") {
+		return "", err
+	}
+	return strings.TrimRight(answer, "\r\n"), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// config is what pastely login stores
+type config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+// configPath returns the path of the config file, which lives under
+// $XDG_CONFIG_HOME, or ~/.config if that isn't set
+func configPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "pastely", "config.json"), nil
+}
+
+// loadConfig reads the config file. a missing file is an empty config.
+// PASTELY_SERVER and PASTELY_TOKEN take precedence over the file.
+func loadConfig() (*config, error) {
+	cfg := &config{}
+
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(data, cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if server := os.Getenv("PASTELY_SERVER"); server != "" {
+		cfg.Server = server
+	}
+	if token := os.Getenv("PASTELY_TOKEN"); token != "" {
+		cfg.Token = token
+	}
+	return cfg, nil
+}
+
+// save writes the config file. only the user can read it, as it holds
+// the token.
+func (c *config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
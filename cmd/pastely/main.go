@@ -0,0 +1,110 @@
+// Command pastely is a command-line client for Pastely.
+//
+//	make 2>&1 | pastely create -t "build log" -e 7d
+//	pastely get 42
+//	pastely list
+//	pastely delete 42
+//	pastely login -server https://pastely.example.com
+//
+// Output is meant to be used by scripts: create prints the URL of the new
+// snippet, get prints its content, list prints one tab separated line per
+// snippet. Errors go to stderr.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"al.imran.pastely/pkg/client"
+)
+
+// errUsage is returned by commands that were called the wrong way, the
+// usage has been printed already
+var errUsage = errors.New("usage")
+
+// a command of the CLI
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, cfg *config, args []string) error
+}
+
+var commands = []command{
+	{"create", "create a snippet from stdin and print its URL", runCreate},
+	{"get", "print the content of a snippet", runGet},
+	{"list", "list the latest snippets", runList},
+	{"delete", "delete one of your snippets", runDelete},
+	{"login", "log in and store an access token", runLogin},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fatal(err)
+	}
+
+	// stop waiting for the server on ctrl-c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+
+		err = cmd.run(ctx, cfg, os.Args[2:])
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if os.Args[1] != "help" && os.Args[1] != "-h" && os.Args[1] != "--help" {
+		fmt.Fprintf(os.Stderr, "pastely: unknown command %q\n", os.Args[1])
+	}
+	usage()
+	os.Exit(2)
+}
+
+// usage prints the list of commands
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: pastely <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nrun pastely <command> -h for the flags of a command")
+}
+
+// fatal prints err and exits. errors of the client are made readable.
+func fatal(err error) {
+	switch {
+	case errors.Is(err, client.ErrNoRecord):
+		err = errors.New("snippet not found")
+	case errors.Is(err, client.ErrInvalidCredential):
+		err = errors.New("not logged in or the token is invalid, run pastely login")
+	}
+	fmt.Fprintln(os.Stderr, "pastely:", err)
+	os.Exit(1)
+}
+
+// newClient returns a client for the configured server
+func newClient(cfg *config) (*client.Client, error) {
+	if cfg.Server == "" {
+		return nil, errors.New("no server configured, run pastely login or set PASTELY_SERVER")
+	}
+	c := client.New(cfg.Server, cfg.Token)
+	c.UserAgent = "pastely-cli"
+	return c, nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/validator"
+)
+
+// struct to hold the form for deleting any snippet by its id
+type adminSnippetDeleteForm struct {
+	ID                  int `form:"id"`
+	validator.Validator `form:"-"`
+}
+
+// struct to hold the form for changing the role of a user
+type adminRoleForm struct {
+	Role                string `form:"role"`
+	validator.Validator `form:"-"`
+}
+
+// Handler for the admin dashboard with site-wide counts
+func (app *application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	users, err := app.user.Count()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	activeSnippets, expiredSnippets, err := app.snippets.Count()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	expiredTokens, err := app.tokens.CountExpired()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Stats = map[string]int{
+		"Users":           users,
+		"ActiveSnippets":  activeSnippets,
+		"ExpiredSnippets": expiredSnippets,
+		"ExpiredTokens":   expiredTokens,
+	}
+	data.Form = adminSnippetDeleteForm{}
+	app.render(w, http.StatusOK, "admin.tmpl.html", data)
+}
+
+// Handler for listing and searching users
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	users, err := app.user.Search(query, 50)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Users = users
+	data.Form = map[string]string{"Query": query}
+	app.render(w, http.StatusOK, "admin_users.tmpl.html", data)
+}
+
+// Handler for banning a user. they are logged out everywhere right away.
+func (app *application) adminUserBanPost(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	// an admin locking themselves out is almost certainly a mistake
+	if id == contextGetUser(r).ID {
+		app.sessionManager.Put(r.Context(), "flash", "You can't ban yourself.")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err = app.user.SetDisabled(id, true)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.revokeAllSessions(id, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The user has been banned.")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// Handler for unbanning a user
+func (app *application) adminUserUnbanPost(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	err = app.user.SetDisabled(id, false)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The user has been unbanned.")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// Handler for changing the role of a user
+func (app *application) adminUserRolePost(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	var form adminRoleForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedString(form.Role, models.RoleUser, models.RoleModerator, models.RoleAdmin), "role", "This field must equal to user, moderator or admin")
+	if !form.Valid() || id == contextGetUser(r).ID {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.user.SetRole(id, form.Role)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The role has been changed.")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// Handler for forcing a user to reset their password. The current password
+// stops working, the user is logged out and gets a reset link by email.
+func (app *application) adminUserResetPasswordPost(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	user, err := app.user.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// replace the password with a random one nobody knows
+	random, err := models.RandomString()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.user.UpdatePassword(user.ID, random)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.revokeAllSessions(user.ID, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	ttl := 24 * time.Hour
+	token, err := app.tokens.New(user.ID, models.ScopePasswordReset, ttl)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	mailData := map[string]any{
+		"Name": user.Name,
+		"URL":  app.baseURL + "/user/password/reset?token=" + url.QueryEscape(token),
+		"TTL":  ttl.String(),
+	}
+	app.background(func() {
+		err := app.mailer.Send(user.Email, "password_reset.tmpl", mailData)
+		if err != nil {
+			app.errorLogger.Print(err)
+		}
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "The user has to reset their password and was sent a link.")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// Handler for deleting any snippet. the id comes from the dashboard form or
+// from the delete button on the snippet page.
+func (app *application) adminSnippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form adminSnippetDeleteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(form.ID > 0, "id", "This field must be a snippet id")
+
+	if form.Valid() {
+		err = app.snippets.Delete(form.ID)
+		if errors.Is(err, models.ErrNoRecord) {
+			form.AddFiledError("id", "There is no snippet with this id")
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.sessionManager.Put(r.Context(), "flash", form.FieldErrors["id"])
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The snippet has been deleted.")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// struct to hold the form for creating an invite code
+type adminInviteForm struct {
+	Note                string `form:"note"`
+	MaxUses             int    `form:"max_uses"`
+	Expires             int    `form:"expires"`
+	validator.Validator `form:"-"`
+}
+
+// Handler for listing invite codes
+func (app *application) adminInvites(w http.ResponseWriter, r *http.Request) {
+	app.renderAdminInvites(w, r, http.StatusOK, adminInviteForm{MaxUses: 1, Expires: 7}, "")
+}
+
+// renderAdminInvites shows the invites page with the form and, right after
+// an invite was created, its code. that is the only time it is shown.
+func (app *application) renderAdminInvites(w http.ResponseWriter, r *http.Request, status int, form adminInviteForm, newCode string) {
+	invites, err := app.invites.All()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Invites = invites
+	data.NewInviteCode = newCode
+	data.Form = form
+	app.render(w, status, "admin_invites.tmpl.html", data)
+}
+
+// Handler for creating an invite code
+func (app *application) adminInviteCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form adminInviteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.MaxCharCount(form.Note, 100), "note", "This field cannot contain more than 100 characters")
+	form.CheckField(form.MaxUses >= 1 && form.MaxUses <= 1000, "max_uses", "This field must be between 1 and 1000")
+	form.CheckField(validator.PermittedInt(form.Expires, 0, 1, 7, 30), "expires", "This field must equal to 0, 1, 7 or 30")
+
+	if !form.Valid() {
+		app.renderAdminInvites(w, r, http.StatusUnprocessableEntity, form, "")
+		return
+	}
+
+	ttl := time.Duration(form.Expires) * 24 * time.Hour
+	code, err := app.invites.Insert(contextGetUser(r).ID, form.Note, form.MaxUses, ttl)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderAdminInvites(w, r, http.StatusOK, adminInviteForm{MaxUses: 1, Expires: 7}, code)
+}
+
+// Handler for revoking an invite code
+func (app *application) adminInviteDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	err = app.invites.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The invite has been revoked.")
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
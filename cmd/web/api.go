@@ -0,0 +1,462 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/validator"
+)
+
+// apiSnippet is how the JSON API shows a snippet
+type apiSnippet struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	Owner    int       `json:"owner,omitempty"` // the id of the user, if any
+	Language string    `json:"language,omitempty"`
+	URL      string    `json:"url"`
+}
+
+// apiSnippetUpdate holds a request to update a snippet, fields that are
+// left out are not changed
+type apiSnippetUpdate struct {
+	Title          *string `json:"title"`
+	Content        *string `json:"content"`
+	Expires        *int    `json:"expires"`
+	Language       *string `json:"language"`
+	ConfirmSecrets bool    `json:"confirm_secrets"`
+}
+
+// newAPISnippet converts a snippet for the JSON API
+func (app *application) newAPISnippet(s *models.Snippet) apiSnippet {
+	return apiSnippet{
+		ID:       s.ID,
+		Title:    s.Title,
+		Content:  s.Content,
+		Created:  s.Created,
+		Expires:  s.Expires,
+		Owner:    s.UserID,
+		Language: s.Language,
+		URL:      fmt.Sprintf("%s/snippet/view/%d", app.baseURL, s.ID),
+	}
+}
+
+// apiOwnSnippet returns the snippet with the id of the request if it belongs
+// to the current user. otherwise it sends an error and returns nil.
+func (app *application) apiOwnSnippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFoundJSON(w)
+		return nil
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundJSON(w)
+		} else {
+			app.serverErrorJSON(w, err)
+		}
+		return nil
+	}
+
+	// we don't tell other users that the snippet exists
+	if snippet.UserID != contextGetUser(r).ID {
+		app.notFoundJSON(w)
+		return nil
+	}
+	return snippet
+}
+
+// Handler for listing snippets. ?mine=true lists the snippets of the owner
+// of the access token instead of the public ones.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var v validator.Validator
+
+	page, err := readIntQuery(query.Get("page"), 1)
+	v.CheckField(err == nil && page >= 1 && page <= maxPage, "page", fmt.Sprintf("This field must be between 1 and %d", maxPage))
+	pageSize, err := readIntQuery(query.Get("page_size"), 20)
+	v.CheckField(err == nil && pageSize >= 1 && pageSize <= 100, "page_size", "This field must be between 1 and 100")
+	mine, err := strconv.ParseBool(query.Get("mine"))
+	v.CheckField(err == nil || query.Get("mine") == "", "mine", "This field must be true or false")
+
+	if !v.Valid() {
+		app.failedValidationJSON(w, v)
+		return
+	}
+
+	var userID int
+	if mine {
+		user := contextGetUser(r)
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.errorJSON(w, http.StatusUnauthorized, "you must use an access token to list your own snippets")
+			return
+		}
+		userID = user.ID
+	}
+
+	snippets, err := app.snippets.List(userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+		return
+	}
+
+	list := []apiSnippet{}
+	for _, s := range snippets {
+		list = append(list, app.newAPISnippet(s))
+	}
+
+	data := envelope{
+		"snippets": list,
+		"metadata": envelope{"page": page, "page_size": pageSize},
+	}
+	err = app.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+	}
+}
+
+// Handler for creating a snippet
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	form := snippetCreateForm{Expires: 365}
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal to 1, 7 or 365")
+	app.validateSnippet(&form)
+
+	if !form.Valid() {
+		app.failedValidationJSON(w, form.Validator)
+		return
+	}
+
+	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires, contextGetUser(r).ID, form.Language, models.VisibilityPublic)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"snippet": app.newAPISnippet(snippet)}, headers)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+	}
+}
+
+// Handler for showing a snippet
+func (app *application) apiSnippetView(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFoundJSON(w)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundJSON(w)
+		} else {
+			app.serverErrorJSON(w, err)
+		}
+		return
+	}
+
+	if !snippet.CanView(contextGetUserID(r)) {
+		app.notFoundJSON(w)
+		return
+	}
+
+	// like snippetView, only moderators can see hidden snippets
+	if snippet.Hidden {
+		user := contextGetUser(r)
+		if user == nil || !user.HasRole(models.RoleModerator) {
+			app.errorJSON(w, http.StatusUnavailableForLegalReasons, "this snippet has been hidden pending review")
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"snippet": app.newAPISnippet(snippet)}, nil)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+	}
+}
+
+// Handler for updating a snippet, only its owner can do this
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	snippet := app.apiOwnSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	// the reported content has to stay as it is while a moderator reviews it
+	if snippet.Hidden {
+		app.errorJSON(w, http.StatusUnavailableForLegalReasons, "this snippet has been hidden pending review and can't be changed")
+		return
+	}
+
+	var input apiSnippetUpdate
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form := snippetCreateForm{
+		Title:          snippet.Title,
+		Content:        snippet.Content,
+		Language:       snippet.Language,
+		ConfirmSecrets: input.ConfirmSecrets,
+	}
+	if input.Title != nil {
+		form.Title = *input.Title
+	}
+	if input.Content != nil {
+		form.Content = *input.Content
+	}
+	if input.Language != nil {
+		form.Language = *input.Language
+	}
+	if input.Expires != nil {
+		form.Expires = *input.Expires
+		form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal to 1, 7 or 365")
+	}
+	app.validateSnippet(&form)
+
+	if !form.Valid() {
+		app.failedValidationJSON(w, form.Validator)
+		return
+	}
+
+	err = app.snippets.Update(snippet.ID, form.Title, form.Content, form.Language, form.Expires)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+		return
+	}
+
+	snippet, err = app.snippets.Get(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundJSON(w)
+		} else {
+			app.serverErrorJSON(w, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"snippet": app.newAPISnippet(snippet)}, nil)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+	}
+}
+
+// Handler for deleting a snippet, only its owner can do this
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	snippet := app.apiOwnSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	err := app.snippets.Delete(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundJSON(w)
+		} else {
+			app.serverErrorJSON(w, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "snippet successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+	}
+}
+
+// the highest page number a list can be asked for. pages hold 100 items at
+// most, so the offset of a page stays within what mysql accepts.
+const maxPage = math.MaxInt32 / 100
+
+// readIntQuery parses an integer query parameter, returning def if it's empty
+func readIntQuery(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// apiUser is how the JSON API shows a user
+type apiUser struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Created  time.Time `json:"created"`
+	Verified bool      `json:"verified"`
+	Role     string    `json:"role"`
+}
+
+// newAPIUser converts a user for the JSON API
+func newAPIUser(u *models.User) apiUser {
+	return apiUser{
+		ID:       u.ID,
+		Name:     u.Name,
+		Email:    u.Email,
+		Created:  u.Created,
+		Verified: u.VerifiedAt.Valid,
+		Role:     u.Role,
+	}
+}
+
+// apiTokenRequest holds a request to create a personal access token with an
+// email and password, which is how command-line clients log in
+type apiTokenRequest struct {
+	Email               string   `json:"email"`
+	Password            string   `json:"password"`
+	Name                string   `json:"name"`
+	Scopes              []string `json:"scopes"`
+	Expires             int      `json:"expires"`
+	validator.Validator `json:"-"`
+}
+
+// Handler for showing the owner of the access token
+func (app *application) apiUserView(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": newAPIUser(contextGetUser(r))}, nil)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+	}
+}
+
+// Handler for changing the name and email of the owner of the access token.
+// like on the account page, the current password is needed for a new email
+// address, or a leaked token could be used to take over the account.
+func (app *application) apiUserUpdate(w http.ResponseWriter, r *http.Request) {
+	user := contextGetUser(r)
+
+	var input struct {
+		Name            *string `json:"name"`
+		Email           *string `json:"email"`
+		CurrentPassword string  `json:"current_password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form := accountProfileForm{Name: user.Name, Email: user.Email, CurrentPassword: input.CurrentPassword}
+	if input.Name != nil {
+		form.Name = *input.Name
+	}
+	if input.Email != nil {
+		form.Email = *input.Email
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank!")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank!")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be valid email address")
+	if !strings.EqualFold(form.Email, user.Email) {
+		app.checkEmailDomain(&form.Validator, "email", form.Email)
+		err = app.checkCurrentPassword(&form.Validator, user.ID, form.CurrentPassword)
+		if err != nil {
+			app.serverErrorJSON(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.failedValidationJSON(w, form.Validator)
+		return
+	}
+
+	user, err = app.updateProfile(user.ID, form.Name, form.Email)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			app.errorJSON(w, http.StatusConflict, "a user with this email address already exists")
+		} else {
+			app.serverErrorJSON(w, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": newAPIUser(user)}, nil)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+	}
+}
+
+// Handler for creating a personal access token with an email and password
+func (app *application) apiTokenCreate(w http.ResponseWriter, r *http.Request) {
+	input := apiTokenRequest{Expires: 90}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(input.Scopes) == 0 {
+		input.Scopes = models.DefaultAPIScopes
+	}
+
+	input.CheckField(validator.NotBlank(input.Email), "email", "This field cannot be blank")
+	input.CheckField(validator.NotBlank(input.Password), "password", "This field cannot be blank")
+	input.CheckField(validator.NotBlank(input.Name), "name", "This field cannot be blank")
+	input.CheckField(validator.MaxCharCount(input.Name, 100), "name", "This field cannot contain more than 100 characters")
+	for _, scope := range input.Scopes {
+		input.CheckField(validator.PermittedString(scope, models.AllAPIScopes...), "scopes", "Unknown scope")
+	}
+	input.CheckField(validator.PermittedInt(input.Expires, 0, 30, 90, 365), "expires", "This field must equal to 0, 30, 90 or 365")
+
+	if !input.Valid() {
+		app.failedValidationJSON(w, input.Validator)
+		return
+	}
+
+	id, err := app.checkLogin(r, input.Email, input.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredential) {
+			app.errorJSON(w, http.StatusUnauthorized, "invalid email or password")
+		} else if errors.Is(err, errTooManyLogins) {
+			app.errorJSON(w, http.StatusTooManyRequests, "too many failed logins, please try again later")
+		} else if errors.Is(err, models.ErrAccountDisabled) {
+			app.errorJSON(w, http.StatusForbidden, "this account has been disabled")
+		} else if errors.Is(err, models.ErrRegistrationClosed) {
+			app.errorJSON(w, http.StatusForbidden, "there is no account for this user and new accounts can't be created")
+		} else {
+			app.serverErrorJSON(w, err)
+		}
+		return
+	}
+
+	ttl := time.Duration(input.Expires) * 24 * time.Hour
+	token, err := app.apiTokens.Insert(id, input.Name, input.Scopes, ttl)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+		return
+	}
+
+	data := envelope{"token": envelope{"token": token, "name": input.Name, "scopes": input.Scopes}}
+	err = app.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"al.imran.pastely/internal/models"
+)
+
+// a custom type for our context keys, so they can't collide with keys set by
+// other packages
+type contextKey string
+
+const authenticatedUserContextKey = contextKey("authenticatedUser")
+
+// contextSetUser returns a copy of the request with the user added to its context
+func contextSetUser(r *http.Request, user *models.User) *http.Request {
+	ctx := context.WithValue(r.Context(), authenticatedUserContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser returns the authenticated user, or nil if there isn't one
+func contextGetUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(authenticatedUserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// contextGetUserID returns the id of the authenticated user, or 0 if the
+// request is anonymous
+func contextGetUserID(r *http.Request) int {
+	if user := contextGetUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"al.imran.pastely/internal/models"
+	"github.com/go-playground/form/v4"
+)
+
+// fakeDB stands in for mysql in handler tests. queries are answered by the
+// first rule whose statement contains its match, or with no rows if there is
+// none. statements that change something are recorded, so tests can check
+// what a handler did.
+type fakeDB struct {
+	mu    sync.Mutex
+	rules []fakeRule
+	execs []fakeStatement
+	// the id of every inserted row
+	LastInsertID int64
+}
+
+// a canned answer to queries
+type fakeRule struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+}
+
+// a statement that was executed
+type fakeStatement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// newFakeDB returns a fake database and a connection pool that uses it
+func newFakeDB() (*fakeDB, *sql.DB) {
+	db := &fakeDB{LastInsertID: 1}
+	return db, sql.OpenDB(db)
+}
+
+// on answers queries containing match with rows
+func (db *fakeDB) on(match string, columns []string, rows ...[]driver.Value) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rules = append(db.rules, fakeRule{match: match, columns: columns, rows: rows})
+}
+
+// executed returns the executed statements containing match
+func (db *fakeDB) executed(match string) []fakeStatement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var statements []fakeStatement
+	for _, s := range db.execs {
+		if strings.Contains(s.Query, match) {
+			statements = append(statements, s)
+		}
+	}
+	return statements
+}
+
+// newFakeDBApplication returns an application whose models use a fake
+// database, and the database
+func newFakeDBApplication() (*application, *fakeDB) {
+	db, pool := newFakeDB()
+
+	app := newTestApplication()
+	app.snippets = &models.SnippetModel{DB: pool}
+	app.user = &models.UserModel{DB: pool}
+	app.apiTokens = &models.APITokenModel{DB: pool}
+	app.gists = &models.GistModel{DB: pool}
+	app.formDecoder = form.NewDecoder()
+	app.baseURL = "https://pastely.test"
+	app.secretScan = secretScanWarn
+	app.maxPasteSize = 1 << 20
+	return app, db
+}
+
+// onUser answers the queries for the user with the given id
+func (db *fakeDB) onUser(id int, verified bool) {
+	var verifiedAt driver.Value
+	if verified {
+		verifiedAt = time.Now()
+	}
+	db.on("FROM users WHERE id=?",
+		[]string{"id", "name", "email", "hashed_password", "created", "verified_at", "disabled", "role"},
+		[]driver.Value{int64(id), "alice", "alice@example.com", []byte{}, time.Now(), verifiedAt, false, models.RoleUser},
+	)
+}
+
+// onToken answers the queries for a personal access token of the user with
+// the given id, any token that looks like one is accepted
+func (db *fakeDB) onToken(userID int, scopes ...string) {
+	db.on("FROM api_tokens WHERE hash=?",
+		[]string{"id", "user_id", "name", "scopes", "created", "expires", "last_used"},
+		[]driver.Value{int64(1), int64(userID), "test", strings.Join(scopes, ","), time.Now(), nil, nil},
+	)
+}
+
+// a token that onToken accepts
+const fakeAPIToken = "pst_test"
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.db, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.execs = append(s.db.execs, fakeStatement{Query: s.query, Args: args})
+	return fakeResult{s.db.LastInsertID}, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, rule := range s.db.rules {
+		if strings.Contains(s.query, rule.match) {
+			return &fakeRows{columns: rule.columns, rows: rule.rows}, nil
+		}
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeResult struct{ id int64 }
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
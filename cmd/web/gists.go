@@ -0,0 +1,547 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/validator"
+)
+
+// The part of the GitHub Gist API that gist clients and editor integrations
+// use, so they can be pointed at pastely. a gist is a group of snippets, one
+// per file. users are known by their id, which is also their login. see
+// https://docs.github.com/en/rest/gists/gists
+
+// gistJSON is how the Gist API shows a gist
+type gistJSON struct {
+	ID          string                  `json:"id"`
+	URL         string                  `json:"url"`
+	HTMLURL     string                  `json:"html_url"`
+	Description string                  `json:"description"`
+	Public      bool                    `json:"public"`
+	Owner       *gistOwnerJSON          `json:"owner"`
+	Files       map[string]gistFileJSON `json:"files"`
+	Comments    int                     `json:"comments"`
+	Truncated   bool                    `json:"truncated"`
+	Created     time.Time               `json:"created_at"`
+	Updated     time.Time               `json:"updated_at"`
+}
+
+// gistOwnerJSON is how the Gist API shows the owner of a gist
+type gistOwnerJSON struct {
+	Login string `json:"login"`
+	ID    int    `json:"id"`
+}
+
+// gistFileJSON is how the Gist API shows a file, lists leave out the content
+type gistFileJSON struct {
+	Filename  string `json:"filename"`
+	Type      string `json:"type"`
+	Language  string `json:"language,omitempty"`
+	RawURL    string `json:"raw_url"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated"`
+	Content   string `json:"content,omitempty"`
+}
+
+// gistInput holds a request to create or update a gist. updating a file
+// with null deletes it, and a filename renames it.
+type gistInput struct {
+	Description         *string                   `json:"description"`
+	Public              *bool                     `json:"public"`
+	Files               map[string]*gistFileInput `json:"files"`
+	ConfirmSecrets      bool                      `json:"confirm_secrets"` // not part of the Gist API
+	validator.Validator `json:"-"`
+}
+
+// gistFileInput holds the changes to a file of a gist
+type gistFileInput struct {
+	Content  *string `json:"content"`
+	Filename *string `json:"filename"`
+}
+
+// newGistJSON converts a gist for the Gist API, hidden files are left out
+func (app *application) newGistJSON(g *models.Gist, withContent bool) gistJSON {
+	result := gistJSON{
+		ID:          strconv.Itoa(g.ID),
+		URL:         fmt.Sprintf("%s/gists/%d", app.baseURL, g.ID),
+		Description: g.Description,
+		Public:      g.Public,
+		Files:       make(map[string]gistFileJSON),
+		Created:     g.Created,
+		Updated:     g.Updated,
+	}
+	if g.UserID != 0 {
+		result.Owner = &gistOwnerJSON{Login: strconv.Itoa(g.UserID), ID: g.UserID}
+	}
+
+	for _, s := range g.Files {
+		if s.Hidden {
+			continue
+		}
+		// there are no pages for gists, so the page of the first file will do
+		if result.HTMLURL == "" {
+			result.HTMLURL = fmt.Sprintf("%s/snippet/view/%d", app.baseURL, s.ID)
+		}
+
+		file := gistFileJSON{
+			Filename: s.Title,
+			Type:     "text/plain",
+			Language: s.Language,
+			RawURL:   fmt.Sprintf("%s/raw/%d", app.baseURL, s.ID),
+			Size:     len(s.Content),
+		}
+		if withContent {
+			file.Content = s.Content
+		}
+		result.Files[s.Title] = file
+	}
+	return result
+}
+
+// gistError sends an error the way GitHub does
+func (app *application) gistError(w http.ResponseWriter, status int, message string) {
+	err := app.writeJSON(w, status, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// gistFailedValidation sends the errors of a validator with status 422, the
+// way GitHub does
+func (app *application) gistFailedValidation(w http.ResponseWriter, v validator.Validator) {
+	errs := []envelope{}
+	for _, message := range v.NonFieldErrors {
+		errs = append(errs, envelope{"resource": "Gist", "code": "custom", "message": message})
+	}
+	for _, field := range slices.Sorted(maps.Keys(v.FieldErrors)) {
+		errs = append(errs, envelope{"resource": "Gist", "code": "invalid", "field": field, "message": v.FieldErrors[field]})
+	}
+
+	err := app.writeJSON(w, http.StatusUnprocessableEntity, envelope{"message": "Validation Failed", "errors": errs}, nil)
+	if err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// gistAuthenticate is apiAuthenticate for the Gist API. GitHub clients send
+// "Authorization: token <token>", which is accepted as well.
+func (app *application) gistAuthenticate(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if plaintext, ok := strings.CutPrefix(r.Header.Get("Authorization"), "token "); ok {
+				r.Header.Set("Authorization", "Bearer "+plaintext)
+			}
+
+			user, err := app.tokenUser(r, scope)
+			if err != nil {
+				switch {
+				case errors.Is(err, models.ErrInvalidToken):
+					app.gistError(w, http.StatusUnauthorized, "Bad credentials")
+				case errors.Is(err, errInsufficientScope):
+					app.gistError(w, http.StatusForbidden, "The access token needs the "+scope+" scope")
+				default:
+					app.serverError(w, err)
+				}
+				return
+			}
+			if user != nil {
+				r = contextSetUser(r, user)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// gistUser returns the user of the request, who must be verified if
+// verified is set. otherwise it sends an error and returns nil.
+func (app *application) gistUser(w http.ResponseWriter, r *http.Request, verified bool) *models.User {
+	user := contextGetUser(r)
+	if user == nil {
+		app.gistError(w, http.StatusUnauthorized, "Requires authentication")
+		return nil
+	}
+	if verified && !user.VerifiedAt.Valid {
+		app.gistError(w, http.StatusForbidden, "Please verify your email address first")
+		return nil
+	}
+	return user
+}
+
+// gistOwnGist returns the gist with the id of the request if it belongs to
+// user. otherwise it sends an error and returns nil.
+func (app *application) gistOwnGist(w http.ResponseWriter, r *http.Request, user *models.User) *models.Gist {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.gistError(w, http.StatusNotFound, "Not Found")
+		return nil
+	}
+
+	gist, err := app.gists.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.gistError(w, http.StatusNotFound, "Not Found")
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	// we don't tell other users that the gist exists
+	if gist.UserID != user.ID {
+		app.gistError(w, http.StatusNotFound, "Not Found")
+		return nil
+	}
+	return gist
+}
+
+// gistLanguage guesses the language of a file from its extension
+func gistLanguage(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	if ext == "txt" {
+		return ""
+	}
+	return ext
+}
+
+// validateGistFiles checks the files of a gist like snippets are checked and
+// returns them in order of their names, with secrets redacted if that is
+// configured. mysql compares file names case-insensitively, so names that
+// only differ in case are refused.
+func (app *application) validateGistFiles(input *gistInput, files map[string]string) []models.GistFile {
+	result := []models.GistFile{}
+	seen := make(map[string]bool)
+	secrets := false
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		input.CheckField(!seen[strings.ToLower(name)], "files."+name, "filename: A file with this name already exists")
+		seen[strings.ToLower(name)] = true
+
+		form := snippetCreateForm{Title: name, Content: files[name], Language: gistLanguage(name), ConfirmSecrets: input.ConfirmSecrets}
+		app.validateSnippet(&form)
+		secrets = secrets || len(form.SecretKinds) > 0
+
+		input.CheckField(!strings.Contains(name, "/"), "files."+name, "filename: This field cannot contain a slash")
+		for field, message := range form.FieldErrors {
+			if field == "title" {
+				field = "filename"
+			}
+			input.AddFiledError("files."+name, field+": "+message)
+		}
+		for _, message := range form.NonFieldErrors {
+			input.AddNonFieldError(name + ": " + message)
+		}
+
+		result = append(result, models.GistFile{Name: name, Content: form.Content, Language: form.Language})
+	}
+	if secrets && app.secretScan == secretScanWarn && !input.ConfirmSecrets {
+		input.AddNonFieldError("Send \"confirm_secrets\": true to publish it anyway.")
+	}
+	return result
+}
+
+// readGistInput reads a request to create or update a gist. secrets can also
+// be confirmed with an X-Confirm-Secrets header, for clients that can't add
+// fields to their requests.
+func (app *application) readGistInput(w http.ResponseWriter, r *http.Request, input *gistInput) error {
+	err := app.readJSON(w, r, input)
+	if err != nil {
+		return err
+	}
+	if confirm, err := strconv.ParseBool(r.Header.Get("X-Confirm-Secrets")); err == nil && confirm {
+		input.ConfirmSecrets = true
+	}
+	return nil
+}
+
+// readGistPagination reads the page and per_page query parameters. on
+// failure it sends an error and returns false.
+func (app *application) readGistPagination(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	query := r.URL.Query()
+	var v validator.Validator
+
+	page, err := readIntQuery(query.Get("page"), 1)
+	v.CheckField(err == nil && page >= 1 && page <= maxPage, "page", fmt.Sprintf("This field must be between 1 and %d", maxPage))
+	perPage, err := readIntQuery(query.Get("per_page"), 30)
+	v.CheckField(err == nil && perPage >= 1 && perPage <= 100, "per_page", "This field must be between 1 and 100")
+
+	if !v.Valid() {
+		app.gistFailedValidation(w, v)
+		return 0, 0, false
+	}
+	return page, perPage, true
+}
+
+// writeGists sends a list of gists
+func (app *application) writeGists(w http.ResponseWriter, gists []*models.Gist) {
+	list := []gistJSON{}
+	for _, g := range gists {
+		list = append(list, app.newGistJSON(g, false))
+	}
+
+	err := app.writeJSON(w, http.StatusOK, list, nil)
+	if err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// Handler for listing the gists of the owner of the access token
+func (app *application) gistList(w http.ResponseWriter, r *http.Request) {
+	user := app.gistUser(w, r, false)
+	if user == nil {
+		return
+	}
+	page, perPage, ok := app.readGistPagination(w, r)
+	if !ok {
+		return
+	}
+
+	gists, err := app.gists.ForUser(user.ID, true, perPage, (page-1)*perPage)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.writeGists(w, gists)
+}
+
+// Handler for listing the public gists of a user, or all of them if the
+// access token belongs to that user
+func (app *application) gistListForUser(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.gistError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	page, perPage, ok := app.readGistPagination(w, r)
+	if !ok {
+		return
+	}
+
+	gists, err := app.gists.ForUser(id, contextGetUserID(r) == id, perPage, (page-1)*perPage)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.writeGists(w, gists)
+}
+
+// Handler for showing a gist, secret gists are shown to anyone with the id
+func (app *application) gistView(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.gistError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	gist, err := app.gists.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.gistError(w, http.StatusNotFound, "Not Found")
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, app.newGistJSON(gist, true), nil)
+	if err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// Handler for creating a gist
+func (app *application) gistCreate(w http.ResponseWriter, r *http.Request) {
+	user := app.gistUser(w, r, true)
+	if user == nil {
+		return
+	}
+
+	var input gistInput
+	err := app.readGistInput(w, r, &input)
+	if err != nil {
+		app.gistError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var description string
+	if input.Description != nil {
+		description = *input.Description
+	}
+	input.CheckField(validator.MaxCharCount(description, 255), "description", "This field cannot contain more than 255 characters")
+
+	files := make(map[string]string)
+	for name, file := range input.Files {
+		if file == nil || file.Content == nil {
+			input.AddFiledError("files."+name, "content: This field cannot be blank")
+			continue
+		}
+		files[name] = *file.Content
+	}
+	input.CheckField(len(files) > 0, "files", "A gist needs at least one file")
+	gistFiles := app.validateGistFiles(&input, files)
+
+	if !input.Valid() {
+		app.gistFailedValidation(w, input.Validator)
+		return
+	}
+
+	// gists are secret unless they are made public
+	public := input.Public != nil && *input.Public
+
+	id, err := app.gists.Insert(user.ID, description, public, gistFiles)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	gist, err := app.gists.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("%s/gists/%d", app.baseURL, id))
+
+	err = app.writeJSON(w, http.StatusCreated, app.newGistJSON(gist, true), headers)
+	if err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// Handler for updating a gist, only its owner can do this. whether a gist
+// is public can't be changed, like on GitHub.
+func (app *application) gistUpdate(w http.ResponseWriter, r *http.Request) {
+	user := app.gistUser(w, r, true)
+	if user == nil {
+		return
+	}
+	gist := app.gistOwnGist(w, r, user)
+	if gist == nil {
+		return
+	}
+
+	var input gistInput
+	err := app.readGistInput(w, r, &input)
+	if err != nil {
+		app.gistError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	description := gist.Description
+	if input.Description != nil {
+		description = *input.Description
+	}
+	input.CheckField(validator.MaxCharCount(description, 255), "description", "This field cannot contain more than 255 characters")
+
+	// files hidden pending review can be deleted but not changed, so they
+	// are kept out of the files that can be edited and kept as they are
+	files := make(map[string]string)
+	hidden := make(map[string]*models.Snippet)
+	for _, s := range gist.Files {
+		if s.Hidden {
+			hidden[strings.ToLower(s.Title)] = s
+		} else {
+			files[s.Title] = s.Content
+		}
+	}
+
+	// take the changed files out first, so a file can be renamed to the
+	// name of another one that is renamed or deleted in the same request
+	names := slices.Sorted(maps.Keys(input.Files))
+	old := make(map[string]string)
+	for _, name := range names {
+		if s, ok := hidden[strings.ToLower(name)]; ok {
+			if input.Files[name] == nil && s.Title == name {
+				delete(hidden, strings.ToLower(name))
+			} else {
+				input.AddFiledError("files."+name, "This file has been hidden pending review and can't be changed")
+			}
+			continue
+		}
+		if content, exists := files[name]; exists {
+			old[name] = content
+			delete(files, name)
+		}
+	}
+
+	for _, name := range names {
+		file := input.Files[name]
+		if file == nil || hidden[strings.ToLower(name)] != nil {
+			continue
+		}
+
+		content, exists := old[name]
+		if file.Content != nil {
+			content = *file.Content
+		} else if !exists {
+			input.AddFiledError("files."+name, "content: This field cannot be blank")
+			continue
+		}
+		filename := name
+		if file.Filename != nil {
+			filename = *file.Filename
+		}
+
+		_, taken := files[filename]
+		if taken || hidden[strings.ToLower(filename)] != nil {
+			input.AddFiledError("files."+name, "filename: A file with this name already exists")
+			continue
+		}
+		files[filename] = content
+	}
+	input.CheckField(len(files)+len(hidden) > 0, "files", "A gist needs at least one file")
+	gistFiles := app.validateGistFiles(&input, files)
+	for _, s := range hidden {
+		gistFiles = append(gistFiles, models.GistFile{Name: s.Title, Content: s.Content, Language: s.Language, Hidden: true})
+	}
+
+	if !input.Valid() {
+		app.gistFailedValidation(w, input.Validator)
+		return
+	}
+
+	err = app.gists.Update(gist.ID, description, gistFiles)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	gist, err = app.gists.Get(gist.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, app.newGistJSON(gist, true), nil)
+	if err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// Handler for deleting a gist and its files, only its owner can do this
+func (app *application) gistDelete(w http.ResponseWriter, r *http.Request) {
+	user := app.gistUser(w, r, false)
+	if user == nil {
+		return
+	}
+	gist := app.gistOwnGist(w, r, user)
+	if gist == nil {
+		return
+	}
+
+	err := app.gists.Delete(gist.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"al.imran.pastely/internal/models"
 	"al.imran.pastely/internal/validator"
@@ -23,17 +26,79 @@ type userSignUpForm struct {
 	Name                string `form:"name"`
 	Email               string `form:"email"`
 	Password            string `form:"password"`
+	InviteCode          string `form:"invite_code"`
 	validator.Validator `form:"-"`
 }
 
-// creating a struct to hold the snippet create and any error that user may input
-type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+// struct to hold the forgot password form
+type passwordForgotForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+// struct to hold the password reset form, the token comes from the emailed link
+type passwordResetForm struct {
+	Token               string `form:"token"`
+	Password            string `form:"password"`
+	ConfirmPassword     string `form:"confirm_password"`
+	validator.Validator `form:"-"`
+}
+
+// struct to hold the email verification form, the token comes from the emailed link
+type userVerifyForm struct {
+	Token               string `form:"token"`
+	validator.Validator `form:"-"`
+}
+
+// struct to hold the change password form
+type accountPasswordForm struct {
+	CurrentPassword     string `form:"current_password"`
+	NewPassword         string `form:"new_password"`
+	ConfirmPassword     string `form:"confirm_password"`
+	validator.Validator `form:"-"`
+}
+
+// struct to hold the change name and email form
+type accountProfileForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	CurrentPassword     string `form:"current_password"`
+	validator.Validator `form:"-"`
+}
+
+// struct to hold the delete account form
+type accountDeleteForm struct {
+	Password            string `form:"password"`
+	Snippets            string `form:"snippets"`
 	validator.Validator `form:"-"`
 }
 
+// struct to hold the form for logging out a single device
+type accountSessionForm struct {
+	ID                  int `form:"id"`
+	validator.Validator `form:"-"`
+}
+
+// struct to hold the form for creating a personal access token
+type accountTokenForm struct {
+	Name                string   `form:"name"`
+	Scopes              []string `form:"scopes"`
+	Expires             int      `form:"expires"`
+	validator.Validator `form:"-"`
+}
+
+// creating a struct to hold the snippet create and any error that user may input.
+// the JSON API decodes its requests into it as well.
+type snippetCreateForm struct {
+	Title               string   `form:"title" json:"title"`
+	Content             string   `form:"content" json:"content"`
+	Expires             int      `form:"expires" json:"expires"`
+	Language            string   `form:"language" json:"language"`
+	ConfirmSecrets      bool     `form:"confirm_secrets" json:"confirm_secrets"`
+	SecretKinds         []string `form:"-" json:"-"`
+	validator.Validator `form:"-" json:"-"`
+}
+
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	snippets, err := app.snippets.Latest()
 	if err != nil {
@@ -70,12 +135,26 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// private snippets don't exist for anyone but their owner
+	if !snippet.CanView(contextGetUserID(r)) {
+		app.notFound(w)
+		return
+	}
 	// storing all the templateData to data variable
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	data.Form = snippetReportForm{}
+	data.User = contextGetUser(r)
+
+	// hidden snippets are only shown to moderators, who have to review them.
+	// everyone else gets a notice with 451 Unavailable For Legal Reasons.
+	if snippet.Hidden && !data.IsModerator {
+		app.render(w, http.StatusUnavailableForLegalReasons, "hidden.tmpl.html", data)
+		return
+	}
 
 	// render the page
-	app.render(w, http.StatusOK, "view.tmpl.html", data)
+	app.renderWithChallenge(w, http.StatusOK, "view.tmpl.html", data)
 }
 
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
@@ -97,10 +176,13 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 	// validate the form data
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxCharCount(form.Title, 100), "title", "This field cannot conatn more than 100 characters")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
 	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal to 1, 7 or 365")
+	redacted := app.validateSnippet(&form)
+
+	flash := "Snippet Created Sucessfully!"
+	if redacted {
+		flash = "Snippet Created Sucessfully! Secrets found in it were redacted."
+	}
 
 	// if validation fails, re-render the form with error message
 	if !form.Valid() {
@@ -110,27 +192,103 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 	// insert the snippet data to our db
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	userID := contextGetUser(r).ID
+	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires, userID, form.Language, models.VisibilityPublic)
 	if err != nil {
 		app.serverError(w, err)
+		return
 	}
 
 	// adding the flash message to the session data
-	app.sessionManager.Put(r.Context(), "flash", "Snippet Created Sucessfully!")
+	app.sessionManager.Put(r.Context(), "flash", flash)
 
 	// Redirect to the created snippet
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
+// validateSnippet checks the title, content and language of a snippet. it also looks
+// for credentials that were pasted by accident and deals with them the way
+// the site is configured to, reporting whether any were redacted.
+func (app *application) validateSnippet(form *snippetCreateForm) bool {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxCharCount(form.Title, 100), "title", "This field cannot conatn more than 100 characters")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.MaxCharCount(form.Language, 50), "language", "This field cannot contain more than 50 characters")
+
+	matches := []validator.SecretMatch{}
+	if app.secretScan != secretScanOff {
+		matches = validator.ScanSecrets(form.Content)
+	}
+	if len(matches) == 0 {
+		return false
+	}
+	form.SecretKinds = validator.SecretKinds(matches)
+
+	switch app.secretScan {
+	case secretScanWarn:
+		// the form is shown again until the user confirms
+		if !form.ConfirmSecrets {
+			form.AddNonFieldError("This snippet looks like it contains secrets. Please remove them or confirm that you want to publish it anyway.")
+		}
+	case secretScanBlock:
+		form.AddFiledError("content", "This field cannot contain secrets such as keys, tokens or passwords")
+	case secretScanRedact:
+		form.Content = validator.RedactSecrets(form.Content, matches)
+		return true
+	}
+	return false
+}
+
+// Handler for deleting a snippet, only its owner can do this
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.GetAny(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// we don't tell other users that the snippet exists
+	if snippet.UserID != contextGetUser(r).ID {
+		app.notFound(w)
+		return
+	}
+
+	err = app.snippets.Delete(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet deleted.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
 // Handler for user sign up form
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-	data.Form = userSignUpForm{}
-	app.render(w, http.StatusOK, "signup.tmpl.html", data)
+	// invite links carry the code, so it doesn't have to be typed in
+	data.Form = userSignUpForm{InviteCode: r.URL.Query().Get("invite")}
+	app.renderWithChallenge(w, http.StatusOK, "signup.tmpl.html", data)
 }
 
 // Handler for signing up new user
 func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	// nobody can sign up while registration is closed
+	if app.registration == registrationClosed {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
 	// Declare a zero-valued instance of the signupForm struc
 	var form userSignUpForm
 
@@ -146,32 +304,62 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank!")
 	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be valid email address")
 	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank!")
-	form.CheckField(validator.MinCharCount(form.Password, 8), "password", "Password must be at least 8 character long.")
+	app.checkPasswordPolicy(&form.Validator, "password", form.Password, form.Name, form.Email)
+
+	// check the restrictions of the registration mode
+	if app.registration == registrationInvite {
+		form.CheckField(validator.NotBlank(form.InviteCode), "invite_code", "This field cannot be blank!")
+	}
+	app.checkEmailDomain(&form.Validator, "email", form.Email)
+
+	// make bots pay for every signup attempt
+	err = app.checkProofOfWork(r, &form.Validator)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
 	// if the form has any error then re-display the form with 422 status code
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+		app.renderWithChallenge(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
 		return
 	}
-	// Insert the new user to the database
-	err = app.user.Insert(form.Name, form.Email, form.Password)
+	// Insert the new user to the database, using up the invite code if one
+	// is required
+	var id int
+	if app.registration == registrationInvite {
+		id, err = app.user.InsertInvited(form.Name, form.Email, form.Password, strings.TrimSpace(form.InviteCode))
+	} else {
+		id, err = app.user.Insert(form.Name, form.Email, form.Password)
+	}
 	if err != nil {
 		// if error is ErrorDuplicateEmail then we re-display the form with a message
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFiledError("email", "This Email is already used!")
+		if errors.Is(err, models.ErrDuplicateEmail) || errors.Is(err, models.ErrInvalidInvite) {
+			if errors.Is(err, models.ErrInvalidInvite) {
+				form.AddFiledError("invite_code", "This invite code is invalid, expired or used up")
+			} else {
+				form.AddFiledError("email", "This Email is already used!")
+			}
 
 			// Re-display the form
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+			app.renderWithChallenge(w, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
 		} else {
 			app.serverError(w, err)
 		}
 		return
 	}
-	app.sessionManager.Put(r.Context(), "flash", "You've signed up successfully!")
+	// email the user a link to verify their address
+	err = app.sendVerificationEmail(&models.User{ID: id, Name: form.Name, Email: form.Email})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "You've signed up successfully! Please check your email to verify your address.")
 	// Redirect to the log in page
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
@@ -205,7 +393,7 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authenticate the form data
-	id, err := app.user.Authenticate(form.Email, form.Password)
+	id, err := app.checkLogin(r, form.Email, form.Password)
 
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredential) {
@@ -214,29 +402,48 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 			data := app.newTemplateData(r)
 			data.Form = form
 			app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		} else if errors.Is(err, models.ErrAccountDisabled) {
+			form.AddNonFieldError("This account has been disabled")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusForbidden, "login.tmpl.html", data)
+		} else if errors.Is(err, models.ErrRegistrationClosed) {
+			form.AddNonFieldError("There is no account for this address and new accounts can't be created")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusForbidden, "login.tmpl.html", data)
+		} else if errors.Is(err, errTooManyLogins) {
+			form.AddNonFieldError("Too many failed logins, please try again later")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusTooManyRequests, "login.tmpl.html", data)
 		} else {
 			app.serverError(w, err)
 		}
 		return
 	}
 
-	// Use the RenewToken() method on the current session to change the session
-	// ID. It's good practice to generate a new session ID when the
-	// authentication state or privilege levels changes for the user (e.g. login
-	// and logout operations).
-	err = app.sessionManager.RenewToken(r.Context())
+	err = app.logIn(r, id)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "authenticationUserId", id)
-
 	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
 }
 
 // Handler for logingin out a user
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	// forget the device of the session we are about to replace
+	err := app.sessions.Delete(app.sessionManager.Token(r.Context()))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	// adding a new session id
 	app.sessionManager.RenewToken(r.Context())
 
@@ -248,3 +455,583 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// Handler for the forgot password form
+func (app *application) passwordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = passwordForgotForm{}
+	app.renderWithChallenge(w, http.StatusOK, "forgot.tmpl.html", data)
+}
+
+// Handler for emailing a password reset link
+func (app *application) passwordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordForgotForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+
+	err = app.checkProofOfWork(r, &form.Validator)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderWithChallenge(w, http.StatusUnprocessableEntity, "forgot.tmpl.html", data)
+		return
+	}
+
+	// we show the same message whether or not the email belongs to an
+	// account, so the form can't be used to find out who is signed up
+	user, err := app.user.GetByEmail(form.Email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	if user != nil {
+		ttl := time.Hour
+		token, err := app.tokens.New(user.ID, models.ScopePasswordReset, ttl)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		mailData := map[string]any{
+			"Name": user.Name,
+			"URL":  app.baseURL + "/user/password/reset?token=" + url.QueryEscape(token),
+			"TTL":  ttl.String(),
+		}
+		app.background(func() {
+			err := app.mailer.Send(user.Email, "password_reset.tmpl", mailData)
+			if err != nil {
+				app.errorLogger.Print(err)
+			}
+		})
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "If that email belongs to an account, we've sent a link to reset the password.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Handler for the password reset form
+func (app *application) passwordReset(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = passwordResetForm{Token: r.URL.Query().Get("token")}
+	app.render(w, http.StatusOK, "reset.tmpl.html", data)
+}
+
+// Handler for setting a new password with a reset token
+func (app *application) passwordResetPost(w http.ResponseWriter, r *http.Request) {
+	var form passwordResetForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Token), "token", "This reset link is invalid")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(form.Password == form.ConfirmPassword, "confirm_password", "Passwords do not match")
+
+	// the token is only peeked at here, so it isn't used up if the new
+	// password doesn't meet the policy
+	if form.Valid() {
+		id, err := app.tokens.Peek(form.Token, models.ScopePasswordReset)
+		if err == nil {
+			var user *models.User
+			user, err = app.user.Get(id)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			app.checkPasswordPolicy(&form.Validator, "password", form.Password, user.Name, user.Email)
+		} else if !errors.Is(err, models.ErrInvalidToken) {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "reset.tmpl.html", data)
+		return
+	}
+
+	// consuming the token makes sure it can only be used once
+	id, err := app.tokens.Consume(form.Token, models.ScopePasswordReset)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			form.AddNonFieldError("This reset link is invalid or has expired")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "reset.tmpl.html", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.user.UpdatePassword(id, form.Password)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// any other reset link that was sent out is no longer needed
+	err = app.tokens.DeleteAllForUser(id, models.ScopePasswordReset)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// the password is reset when it may be known to someone else, so
+	// whatever they logged in with stops working
+	err = app.revokeAllSessions(id, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.apiTokens.DeleteAllForUser(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset and every device and access token has been logged out, please log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Handler for the email verification form
+func (app *application) userVerify(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userVerifyForm{Token: r.URL.Query().Get("token")}
+	app.render(w, http.StatusOK, "verify.tmpl.html", data)
+}
+
+// Handler for verifying an email address with a verification token
+func (app *application) userVerifyPost(w http.ResponseWriter, r *http.Request) {
+	var form userVerifyForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Token), "token", "This verification link is invalid")
+
+	if form.Valid() {
+		var id int
+		id, err = app.tokens.Consume(form.Token, models.ScopeVerification)
+		if err == nil {
+			err = app.user.Verify(id)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		} else if errors.Is(err, models.ErrInvalidToken) {
+			form.AddNonFieldError("This verification link is invalid or has expired")
+		} else {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "verify.tmpl.html", data)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address has been verified!")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Handler for sending a new verification email to the logged in user
+func (app *application) userVerifyResendPost(w http.ResponseWriter, r *http.Request) {
+	user := contextGetUser(r)
+
+	if user.VerifiedAt.Valid {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is already verified.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// links that were sent earlier are replaced by the new one
+	err := app.tokens.DeleteAllForUser(user.ID, models.ScopeVerification)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sendVerificationEmail(user)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "We've sent you a new verification email.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Handler for the account overview page
+func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.User = contextGetUser(r)
+	app.render(w, http.StatusOK, "account.tmpl.html", data)
+}
+
+// Handler for the change password form
+func (app *application) accountPassword(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountPasswordForm{}
+	app.render(w, http.StatusOK, "password.tmpl.html", data)
+}
+
+// Handler for changing the password of the logged in user
+func (app *application) accountPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var form accountPasswordForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "current_password", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.NewPassword), "new_password", "This field cannot be blank")
+	user := contextGetUser(r)
+	app.checkPasswordPolicy(&form.Validator, "new_password", form.NewPassword, user.Name, user.Email)
+	form.CheckField(form.NewPassword == form.ConfirmPassword, "confirm_password", "Passwords do not match")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "password.tmpl.html", data)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticationUserId")
+
+	// the current password is required so a session left open on a shared
+	// computer can't be used to take over the account
+	err = app.user.CheckPassword(id, form.CurrentPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredential) {
+			form.AddFiledError("current_password", "Current password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "password.tmpl.html", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.user.UpdatePassword(id, form.NewPassword)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// whoever knew the old password shouldn't stay logged in with it
+	err = app.revokeAllSessions(id, app.sessionManager.Token(r.Context()))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been changed and your other devices have been logged out.")
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// Handler for the change name and email form
+func (app *application) accountProfile(w http.ResponseWriter, r *http.Request) {
+	user := contextGetUser(r)
+
+	data := app.newTemplateData(r)
+	data.Form = accountProfileForm{Name: user.Name, Email: user.Email}
+	app.render(w, http.StatusOK, "profile.tmpl.html", data)
+}
+
+// Handler for changing the name and email of the logged in user
+func (app *application) accountProfilePost(w http.ResponseWriter, r *http.Request) {
+	var form accountProfileForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank!")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank!")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be valid email address")
+	// like the password, the email address can only be changed with the
+	// current password, as it is where password reset links go
+	if !strings.EqualFold(form.Email, contextGetUser(r).Email) {
+		app.checkEmailDomain(&form.Validator, "email", form.Email)
+		err = app.checkCurrentPassword(&form.Validator, contextGetUser(r).ID, form.CurrentPassword)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "profile.tmpl.html", data)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticationUserId")
+
+	user, err := app.updateProfile(id, form.Name, form.Email)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFiledError("email", "This Email is already used!")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "profile.tmpl.html", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if !user.VerifiedAt.Valid {
+		app.sessionManager.Put(r.Context(), "flash", "Your details have been updated. Please check your email to verify your new address.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Your details have been updated.")
+	}
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// Handler for the delete account form
+func (app *application) accountDelete(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountDeleteForm{Snippets: "anonymize"}
+	app.render(w, http.StatusOK, "delete.tmpl.html", data)
+}
+
+// Handler for deleting the account of the logged in user
+func (app *application) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form accountDeleteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.PermittedString(form.Snippets, "delete", "anonymize"), "snippets", "This field must equal to delete or anonymize")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "delete.tmpl.html", data)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticationUserId")
+
+	err = app.user.CheckPassword(id, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredential) {
+			form.AddFiledError("password", "Password is incorrect")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, http.StatusUnprocessableEntity, "delete.tmpl.html", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.user.Delete(id, form.Snippets == "delete")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// log the user out, same as userLogoutPost. the user's other sessions
+	// are removed from user_sessions together with the user
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "authenticationUserId")
+
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deleted.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Handler for listing the active sessions of the logged in user
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticationUserId")
+
+	// clean up sessions that expired since the last visit
+	err := app.sessions.DeleteStale()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	sessions, err := app.sessions.GetAllForUser(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	current := app.sessionManager.Token(r.Context())
+	for _, s := range sessions {
+		if s.Token == current {
+			data.CurrentSession = s.ID
+		}
+	}
+	app.render(w, http.StatusOK, "sessions.tmpl.html", data)
+}
+
+// Handler for logging out a single device of the logged in user
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	var form accountSessionForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticationUserId")
+
+	session, err := app.sessions.Get(form.ID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// the current device logs out through the normal logout button
+	if session.Token == app.sessionManager.Token(r.Context()) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.revokeSession(session.Token)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The device has been logged out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// Handler for logging out every device of the logged in user except this one
+func (app *application) accountSessionsRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticationUserId")
+
+	err := app.revokeAllSessions(id, app.sessionManager.Token(r.Context()))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "All other devices have been logged out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// Handler for listing the personal access tokens of the logged in user
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	app.renderAccountTokens(w, r, http.StatusOK, accountTokenForm{Expires: 90}, "")
+}
+
+// renderAccountTokens shows the token page with the form and, right after a
+// token was created, its plain-text value. that is the only time it is shown.
+func (app *application) renderAccountTokens(w http.ResponseWriter, r *http.Request, status int, form accountTokenForm, newToken string) {
+	tokens, err := app.apiTokens.GetAllForUser(contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.APITokens = tokens
+	data.APIScopes = models.AllAPIScopes
+	data.NewAPIToken = newToken
+	data.Form = form
+	app.render(w, status, "tokens.tmpl.html", data)
+}
+
+// Handler for creating a personal access token
+func (app *application) accountTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountTokenForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxCharCount(form.Name, 100), "name", "This field cannot contain more than 100 characters")
+	form.CheckField(len(form.Scopes) > 0, "scopes", "Choose at least one scope")
+	for _, scope := range form.Scopes {
+		form.CheckField(validator.PermittedString(scope, models.AllAPIScopes...), "scopes", "Unknown scope")
+	}
+	form.CheckField(validator.PermittedInt(form.Expires, 0, 30, 90, 365), "expires", "This field must equal to 0, 30, 90 or 365")
+
+	if !form.Valid() {
+		app.renderAccountTokens(w, r, http.StatusUnprocessableEntity, form, "")
+		return
+	}
+
+	ttl := time.Duration(form.Expires) * 24 * time.Hour
+	token, err := app.apiTokens.Insert(contextGetUser(r).ID, form.Name, form.Scopes, ttl)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderAccountTokens(w, r, http.StatusOK, accountTokenForm{Expires: 90}, token)
+}
+
+// Handler for revoking a personal access token
+func (app *application) accountTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	var form accountSessionForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.apiTokens.Delete(form.ID, contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The token has been revoked.")
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/paste"
+	"github.com/julienschmidt/httprouter"
+)
+
+// The hastebin API, so haste clients can use pastely. the key of a document
+// is the id of its snippet. see https://github.com/toptal/haste-server
+
+// hastebin links to documents as /key, with an optional file extension
+var hastebinPathRX = regexp.MustCompile(`^/([0-9]+)(\.[A-Za-z0-9]+)?$`)
+
+// hastebinError sends an error the way hastebin does
+func (app *application) hastebinError(w http.ResponseWriter, status int, message string) {
+	err := app.writeJSON(w, status, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// Handler for creating a document, the body is its content. a document that
+// looks like it contains secrets is only created with confirm_secrets in the
+// query or an X-Confirm-Secrets header.
+func (app *application) hastebinCreate(w http.ResponseWriter, r *http.Request) {
+	user := contextGetUser(r)
+	if user == nil && !app.anonymousPastes {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		app.hastebinError(w, http.StatusUnauthorized, "Anonymous documents are disabled.")
+		return
+	}
+	if user != nil && !user.VerifiedAt.Valid {
+		app.hastebinError(w, http.StatusForbidden, "Please verify your email address first.")
+		return
+	}
+
+	content, filename, err := app.readPaste(w, r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.hastebinError(w, http.StatusRequestEntityTooLarge, "Document exceeds maximum length.")
+		} else {
+			app.hastebinError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	form := snippetCreateForm{
+		Title:   filename,
+		Content: content,
+		Expires: 365,
+	}
+	if form.Title == "" {
+		form.Title = paste.DefaultTitle(content)
+	}
+	confirm := r.URL.Query().Get("confirm_secrets")
+	if confirm == "" {
+		confirm = r.Header.Get("X-Confirm-Secrets")
+	}
+	form.ConfirmSecrets, _ = strconv.ParseBool(confirm)
+	form.CheckField(utf8.ValidString(content), "content", "This field must be text, binary files cannot be pasted")
+	app.validateSnippet(&form)
+
+	if !form.Valid() {
+		message := pasteErrors(form.Validator)
+		if len(form.SecretKinds) > 0 && !form.ConfirmSecrets {
+			message += "\nSend confirm_secrets=1 to publish it anyway."
+		}
+		app.hastebinError(w, http.StatusUnprocessableEntity, message)
+		return
+	}
+
+	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires, contextGetUserID(r), "", models.VisibilityPublic)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"key": strconv.Itoa(id)}, nil)
+	if err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// hastebinSnippet returns the snippet of the key parameter of the route,
+// which may have a file extension like hastebin's links do. if there is no
+// such snippet, or it can't be shown, it sends an error and returns nil.
+func (app *application) hastebinSnippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	key := httprouter.ParamsFromContext(r.Context()).ByName("key")
+	key, _, _ = strings.Cut(key, ".")
+
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		app.hastebinError(w, http.StatusNotFound, "Document not found.")
+		return nil
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.hastebinError(w, http.StatusNotFound, "Document not found.")
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	// there is no way to log in, so private snippets don't exist here
+	if !snippet.CanView(0) {
+		app.hastebinError(w, http.StatusNotFound, "Document not found.")
+		return nil
+	}
+	if snippet.Hidden {
+		app.hastebinError(w, http.StatusUnavailableForLegalReasons, "Document has been hidden pending review.")
+		return nil
+	}
+	return snippet
+}
+
+// Handler for getting a document as JSON
+func (app *application) hastebinView(w http.ResponseWriter, r *http.Request) {
+	snippet := app.hastebinSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	data := envelope{"key": strconv.Itoa(snippet.ID), "data": snippet.Content}
+	err := app.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverError(w, err)
+	}
+}
+
+// Handler for getting the content of a document as plain text
+func (app *application) hastebinRaw(w http.ResponseWriter, r *http.Request) {
+	snippet := app.hastebinSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(snippet.Content))
+}
+
+// hastebinRedirect returns the page of the snippet for a hastebin link like
+// /123 or /123.go, which the router can't match as it has other routes at
+// the root
+func hastebinRedirect(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false
+	}
+
+	match := hastebinPathRX.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		return "", false
+	}
+	return "/snippet/view/" + match[1], true
+}
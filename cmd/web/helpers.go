@@ -2,18 +2,120 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
+	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/validator"
 	"github.com/go-playground/form/v4"
+	"github.com/julienschmidt/httprouter"
 )
 
-// checking if an incoming request is made from a authenticated user or not
+// checking if an incoming request is made from a authenticated user or not.
+// the authenticate middleware only puts enabled users in the request context.
 func (app *application) isAuthenticated(r *http.Request) bool {
-	return app.sessionManager.Exists(r.Context(), "authenticationUserId")
+	return contextGetUser(r) != nil
+}
+
+// checkPasswordPolicy adds a field error under key if password doesn't meet
+// the password policy. all the feedback is shown so the user can fix it at once.
+func (app *application) checkPasswordPolicy(v *validator.Validator, key, password, name, email string) {
+	feedback := app.passwordPolicy.Check(password, name, email)
+	v.CheckField(len(feedback) == 0, key, strings.Join(feedback, " "))
+}
+
+// registrationAllows returns true if the registration mode lets an account
+// with the given email address be created without an invite code. this goes
+// for accounts created on the first single sign-on or directory login too.
+func registrationAllows(mode string, domains []string, email string) bool {
+	switch mode {
+	case registrationOpen:
+		return true
+	case registrationDomain:
+		return validator.EmailDomainIn(email, domains...)
+	}
+	return false
+}
+
+// checkEmailDomain adds a field error under key if the domain registration
+// mode doesn't allow email. it applies to changed addresses as well, or
+// anyone could sign up with an allowed address and then switch to another.
+func (app *application) checkEmailDomain(v *validator.Validator, key, email string) {
+	if app.registration == registrationDomain {
+		v.CheckField(validator.EmailDomainIn(email, app.registrationDomains...), key, "Only addresses at "+strings.Join(app.registrationDomains, ", ")+" can be used")
+	}
+}
+
+// how many logins may fail within loginWindow, for one account and from one
+// IP address, before further attempts are refused
+const (
+	loginFailuresPerAccount = 10
+	loginFailuresPerIP      = 30
+	loginWindow             = 15 * time.Minute
+)
+
+// errTooManyLogins is returned by checkLogin once too many logins failed
+var errTooManyLogins = errors.New("too many failed logins")
+
+// checkLogin checks email and password with the login backends. failed
+// logins are counted per account and per IP address, and errTooManyLogins
+// is returned without checking anything once there were too many of them.
+func (app *application) checkLogin(r *http.Request, email, password string) (int, error) {
+	ip := clientIP(r)
+
+	byEmail, byIP, err := app.loginAttempts.CountRecent(email, ip, time.Now().Add(-loginWindow))
+	if err != nil {
+		return 0, err
+	}
+	if byEmail >= loginFailuresPerAccount || byIP >= loginFailuresPerIP {
+		return 0, errTooManyLogins
+	}
+
+	id, err := app.authenticator.Authenticate(email, password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredential) {
+			if err := app.loginAttempts.Insert(email, ip); err != nil {
+				return 0, err
+			}
+		}
+		return 0, err
+	}
+
+	return id, app.loginAttempts.DeleteForEmail(email)
+}
+
+// checkCurrentPassword adds a field error under current_password if password
+// isn't the password of the user with the given id
+func (app *application) checkCurrentPassword(v *validator.Validator, id int, password string) error {
+	if !validator.NotBlank(password) {
+		v.AddFiledError("current_password", "This field cannot be blank")
+		return nil
+	}
+
+	err := app.user.CheckPassword(id, password)
+	if errors.Is(err, models.ErrInvalidCredential) {
+		v.AddFiledError("current_password", "Current password is incorrect")
+		return nil
+	}
+	return err
+}
+
+// clientIP returns the IP address of the client without the port
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
 }
 
 // creating a helper that would decode the html form and put the data in repective struct fields
@@ -40,14 +142,62 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 	return nil
 }
 
+// checkProofOfWork adds an error to v unless the form carries a solved
+// challenge that wasn't used before. it must be called after the form was
+// parsed.
+func (app *application) checkProofOfWork(r *http.Request, v *validator.Validator) error {
+	if app.pow == nil {
+		return nil
+	}
+
+	challenge, err := app.pow.Verify(r.PostForm.Get("pow_challenge"), r.PostForm.Get("pow_nonce"))
+	if err != nil {
+		v.AddFiledError("pow", "The anti-spam check failed, please try again")
+		return nil
+	}
+
+	err = app.challenges.Use(challenge.ID, challenge.Expires)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			v.AddFiledError("pow", "The anti-spam check failed, please try again")
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
 // creating newTemplateData which returns a pointer to the templateData struct initialize
-// with CurrentYear, any flash message and whether or not the user is authenticated
+// with CurrentYear, any flash message, whether or not the user is authenticated
+// and the name and role of the authenticated user
 func (app *application) newTemplateData(r *http.Request) *templateData {
-	return &templateData{
+	data := &templateData{
 		CurrentYear:     time.Now().Year(),
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
+		OIDCEnabled:     app.oidc != nil,
+		Registration:    app.registration,
+	}
+	if user := contextGetUser(r); user != nil {
+		data.UserName = user.Name
+		data.IsAdmin = user.HasRole(models.RoleAdmin)
+		data.IsModerator = user.HasRole(models.RoleModerator)
 	}
+	return data
+}
+
+// renderWithChallenge is render for the pages with a form that is checked
+// by checkProofOfWork, it gives the form a fresh challenge
+func (app *application) renderWithChallenge(w http.ResponseWriter, status int, page string, data *templateData) {
+	if app.pow != nil {
+		challenge, err := app.pow.New()
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data.Challenge = challenge
+	}
+	app.render(w, status, page, data)
 }
 
 // Rendering the cached template pages
@@ -87,7 +237,233 @@ func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
+// This will display an error for a missing, unknown or expired access token
+func (app *application) invalidToken(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	app.clientError(w, http.StatusUnauthorized)
+}
+
 // This will display pageNotFound error
 func (app *application) notFound(w http.ResponseWriter) {
 	app.clientError(w, http.StatusNotFound)
 }
+
+// background runs fn in a new goroutine, recovering and logging any panic so
+// that it can't crash the server. used for slow work like sending emails.
+func (app *application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLogger.Output(2, fmt.Sprintf("%s\n%s", err, debug.Stack()))
+			}
+		}()
+		fn()
+	}()
+}
+
+// updateProfile changes the name and email of a user and returns the updated
+// user. a changed email address has to be verified again, so a new
+// verification email is sent for it.
+func (app *application) updateProfile(id int, name, email string) (*models.User, error) {
+	err := app.user.UpdateProfile(id, name, email)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := app.user.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.VerifiedAt.Valid {
+		err = app.tokens.DeleteAllForUser(user.ID, models.ScopeVerification)
+		if err != nil {
+			return nil, err
+		}
+
+		err = app.sendVerificationEmail(user)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// sendVerificationEmail creates a new verification token for the user and
+// emails them the link to verify their address in the background
+func (app *application) sendVerificationEmail(user *models.User) error {
+	ttl := 72 * time.Hour
+	token, err := app.tokens.New(user.ID, models.ScopeVerification, ttl)
+	if err != nil {
+		return err
+	}
+
+	mailData := map[string]any{
+		"Name": user.Name,
+		"URL":  app.baseURL + "/user/verify?token=" + url.QueryEscape(token),
+		"TTL":  ttl.String(),
+	}
+	app.background(func() {
+		err := app.mailer.Send(user.Email, "verify_email.tmpl", mailData)
+		if err != nil {
+			app.errorLogger.Print(err)
+		}
+	})
+	return nil
+}
+
+// logIn starts an authenticated session for the user with the given id
+func (app *application) logIn(r *http.Request, id int) error {
+	// Use the RenewToken() method on the current session to change the session
+	// ID. It's good practice to generate a new session ID when the
+	// authentication state or privilege levels changes for the user (e.g. login
+	// and logout operations).
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Put(r.Context(), "authenticationUserId", id)
+
+	// remember the device so the user can see and revoke this session later
+	return app.sessions.Insert(app.sessionManager.Token(r.Context()), id, r.UserAgent(), clientIP(r))
+}
+
+// revokeSession deletes the scs session with the given token, which logs out
+// whoever is using it, and forgets its device details
+func (app *application) revokeSession(token string) error {
+	err := app.sessionManager.Store.Delete(token)
+	if err != nil {
+		return err
+	}
+	return app.sessions.Delete(token)
+}
+
+// revokeAllSessions logs out every session of a user except the one with the
+// token except, which may be empty
+func (app *application) revokeAllSessions(userID int, except string) error {
+	sessions, err := app.sessions.GetAllForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if s.Token == except {
+			continue
+		}
+		err = app.revokeSession(s.Token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIDParam returns the positive integer id parameter of the route
+func readIDParam(r *http.Request) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+	return id, nil
+}
+
+// envelope wraps the data of JSON responses, e.g. {"snippet": {...}}
+type envelope map[string]any
+
+// writeJSON sends data as a JSON response with the given status code
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any, headers http.Header) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+	return nil
+}
+
+// readJSON decodes the JSON request body into dst. the body must be a single
+// JSON value of at most 1MB without any unknown fields. the errors are meant
+// to be shown to the client.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return err
+		}
+	}
+
+	if dec.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+	return nil
+}
+
+// errorJSON sends a JSON error like {"error": "message"} with the given status
+func (app *application) errorJSON(w http.ResponseWriter, status int, message string) {
+	err := app.writeJSON(w, status, envelope{"error": message}, nil)
+	if err != nil {
+		app.errorLogger.Output(2, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// serverErrorJSON is serverError for the JSON API
+func (app *application) serverErrorJSON(w http.ResponseWriter, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.errorLogger.Output(2, trace)
+
+	app.errorJSON(w, http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+}
+
+// notFoundJSON is notFound for the JSON API
+func (app *application) notFoundJSON(w http.ResponseWriter) {
+	app.errorJSON(w, http.StatusNotFound, "the requested resource could not be found")
+}
+
+// failedValidationJSON sends the errors of a validator with status 422, the
+// field errors are keyed by the name of the field
+func (app *application) failedValidationJSON(w http.ResponseWriter, v validator.Validator) {
+	data := envelope{"error": "the request contains invalid fields", "fields": v.FieldErrors}
+	if len(v.NonFieldErrors) > 0 {
+		data["error"] = strings.Join(v.NonFieldErrors, " ")
+	}
+
+	err := app.writeJSON(w, http.StatusUnprocessableEntity, data, nil)
+	if err != nil {
+		app.serverErrorJSON(w, err)
+	}
+}
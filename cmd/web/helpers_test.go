@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"al.imran.pastely/internal/validator"
+)
+
+func newTestApplication() *application {
+	return &application{
+		errorLogger: log.New(io.Discard, "", 0),
+		infoLogger:  log.New(io.Discard, "", 0),
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	app := newTestApplication()
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"Valid", `{"title": "a", "expires": 7}`, ""},
+		{"Empty", ``, "body must not be empty"},
+		{"Badly-formed", `{"title": "a",}`, "body contains badly-formed JSON (at character 15)"},
+		{"Truncated", `{"title": "a"`, "body contains badly-formed JSON"},
+		{"Wrong type", `{"expires": "7"}`, `body contains incorrect JSON type for field "expires"`},
+		{"Wrong top-level type", `["a"]`, "body contains incorrect JSON type (at character 1)"},
+		{"Unknown field", `{"titel": "a"}`, `body contains unknown field "titel"`},
+		{"Two values", `{"title": "a"} {"title": "b"}`, "body must only contain a single JSON value"},
+		{"Too large", `{"title": "` + strings.Repeat("a", 1<<20) + `"}`, "body must not be larger than 1048576 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst struct {
+				Title   string `json:"title"`
+				Expires int    `json:"expires"`
+			}
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+
+			err := app.readJSON(rr, r, &dst)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got error %v; want none", err)
+				}
+				if dst.Title != "a" || dst.Expires != 7 {
+					t.Errorf("got %+v; want the decoded body", dst)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFailedValidationJSON(t *testing.T) {
+	app := newTestApplication()
+
+	tests := []struct {
+		name       string
+		validator  validator.Validator
+		wantError  string
+		wantFields map[string]string
+	}{
+		{
+			name: "Field errors",
+			validator: validator.Validator{
+				FieldErrors: map[string]string{"title": "This field cannot be blank"},
+			},
+			wantError:  "the request contains invalid fields",
+			wantFields: map[string]string{"title": "This field cannot be blank"},
+		},
+		{
+			name: "Non-field errors",
+			validator: validator.Validator{
+				NonFieldErrors: []string{"Something is wrong.", "Something else too."},
+			},
+			wantError:  "Something is wrong. Something else too.",
+			wantFields: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.failedValidationJSON(rr, tt.validator)
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Errorf("got status %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("got Content-Type %q; want application/json", ct)
+			}
+
+			var body struct {
+				Error  string            `json:"error"`
+				Fields map[string]string `json:"fields"`
+			}
+			err := json.NewDecoder(rr.Body).Decode(&body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != tt.wantError {
+				t.Errorf("got error %q; want %q", body.Error, tt.wantError)
+			}
+			if len(body.Fields) != len(tt.wantFields) {
+				t.Errorf("got fields %v; want %v", body.Fields, tt.wantFields)
+			}
+			for key, want := range tt.wantFields {
+				if body.Fields[key] != want {
+					t.Errorf("got field %s %q; want %q", key, body.Fields[key], want)
+				}
+			}
+		})
+	}
+}
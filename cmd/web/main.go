@@ -1,34 +1,85 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"html/template"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"al.imran.pastely/internal/mailer"
 	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/pow"
+	"al.imran.pastely/internal/validator"
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"golang.org/x/crypto/bcrypt"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
 // defining application struct to hold applicatiom-wide dependencies
 type application struct {
-	errorLogger    *log.Logger
-	infoLogger     *log.Logger
-	snippets       *models.SnippetModel
-	user           *models.UserModel
-	templateCache  map[string]*template.Template
-	formDecoder    *form.Decoder
-	sessionManager *scs.SessionManager
+	errorLogger         *log.Logger
+	infoLogger          *log.Logger
+	snippets            *models.SnippetModel
+	user                *models.UserModel
+	tokens              *models.TokenModel
+	sessions            *models.SessionModel
+	reports             *models.ReportModel
+	templateCache       map[string]*template.Template
+	formDecoder         *form.Decoder
+	sessionManager      *scs.SessionManager
+	mailer              mailer.Mailer
+	baseURL             string
+	secretScan          string
+	passwordPolicy      *validator.PasswordPolicy
+	identities          *models.IdentityModel
+	oidc                *oidcConfig
+	authenticator       models.Authenticator
+	apiTokens           *models.APITokenModel
+	invites             *models.InviteModel
+	gists               *models.GistModel
+	sshKeys             *models.SSHKeyModel
+	registration        string
+	registrationDomains []string
+	pow                 *pow.Issuer
+	challenges          *models.ChallengeModel
+	loginAttempts       *models.LoginAttemptModel
+	anonymousPastes     bool
+	maxPasteSize        int64
 }
 
+// who may sign up at /user/signup
+const (
+	registrationOpen   = "open"
+	registrationClosed = "closed"
+	registrationInvite = "invite"
+	registrationDomain = "domain"
+)
+
+// what snippetCreatePost does when a snippet looks like it contains secrets
+const (
+	secretScanOff    = "off"
+	secretScanWarn   = "warn"
+	secretScanBlock  = "block"
+	secretScanRedact = "redact"
+)
+
 func main() {
 	// defining a flag named addr with default value ":4000"
 	addr := flag.String("addr", ":4000", "HTTP network string")
@@ -36,6 +87,78 @@ func main() {
 	// definig a new command-line flag for the mySQL DSN string
 	dsn := flag.String("dsn", "web:whoami7@/pastely?parseTime=true", "mySQL data source name")
 
+	// the public URL of the site, used to build links in emails
+	baseURL := flag.String("base-url", "https://localhost:4000", "Public base URL of the site")
+
+	// flags for sending emails. if mail-dir is set, emails are written to
+	// that directory as .eml files instead of being sent over SMTP
+	smtpHost := flag.String("smtp-host", "localhost", "SMTP host")
+	smtpPort := flag.Int("smtp-port", 25, "SMTP port")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
+	smtpSender := flag.String("smtp-sender", "Pastely <no-reply@pastely.local>", "SMTP sender")
+	mailDir := flag.String("mail-dir", "", "Write emails to this directory instead of sending them")
+
+	// how to handle secrets like API keys that are pasted into snippets
+	secretScan := flag.String("secret-scan", secretScanWarn, "Secrets in snippets: off, warn, block or redact")
+
+	// how new passwords are hashed. existing hashes are upgraded on login
+	passwordAlgo := flag.String("password-algo", models.AlgorithmArgon2id, "Password hashing algorithm: argon2id or bcrypt")
+	bcryptCost := flag.Int("bcrypt-cost", 12, "bcrypt cost")
+	argon2Memory := flag.Uint("argon2-memory", 64*1024, "argon2id memory in KiB")
+	argon2Time := flag.Uint("argon2-time", 3, "argon2id number of passes")
+	argon2Threads := flag.Uint("argon2-threads", 2, "argon2id parallelism")
+
+	// a local list of SHA-1 hashes of breached passwords that are rejected
+	breachedPasswords := flag.String("breached-passwords", "", "File of SHA-1 hashes of breached passwords")
+	minPasswordEntropy := flag.Float64("min-password-entropy", validator.DefaultPasswordPolicy.MinEntropy, "Minimum estimated password entropy in bits")
+
+	// OpenID Connect single sign-on, enabled when an issuer is set
+	oidcIssuer := flag.String("oidc-issuer", "", "OpenID Connect issuer URL")
+	oidcClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	oidcClientSecret := flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	oidcAutoProvision := flag.Bool("oidc-auto-provision", false, "Create users on first OpenID Connect login")
+
+	// the backends that check email and password logins, tried in order
+	authBackends := flag.String("auth-backends", "local", "Comma separated login backends to try in order: local, ldap")
+	ldapURL := flag.String("ldap-url", "ldap://localhost:389", "LDAP server URL")
+	ldapBindDN := flag.String("ldap-bind-dn", "", "LDAP service account DN used to search for users")
+	ldapBindPassword := flag.String("ldap-bind-password", "", "LDAP service account password")
+	ldapBaseDN := flag.String("ldap-base-dn", "", "LDAP base DN to search for users")
+	ldapUserFilter := flag.String("ldap-user-filter", "(mail=%s)", "LDAP filter to find a user, %s is the email")
+	ldapNameAttr := flag.String("ldap-name-attr", "cn", "LDAP attribute holding the user's name")
+	ldapEmailAttr := flag.String("ldap-email-attr", "mail", "LDAP attribute holding the user's email")
+
+	// who may sign up
+	registration := flag.String("registration", registrationOpen, "Registration mode: open, closed, invite or domain")
+	registrationDomains := flag.String("registration-domains", "", "Comma separated email domains allowed to sign up in domain mode")
+
+	// the proof-of-work challenge on the signup, report and forgot password
+	// forms. the difficulty is in bits, every bit doubles the work
+	powDifficulty := flag.Int("pow-difficulty", 16, "Proof-of-work difficulty in bits, 0 turns the challenge off")
+	powMaxDifficulty := flag.Int("pow-max-difficulty", 22, "Highest proof-of-work difficulty under load")
+	powLoadThreshold := flag.Int("pow-load-threshold", 30, "Form submissions per minute before the proof-of-work difficulty goes up")
+	powKey := flag.String("pow-key", "", "Hex encoded key to sign challenges, random if empty")
+
+	// plain-text pastes, e.g. with curl, and who may make them
+	anonymousPastes := flag.Bool("anonymous-pastes", false, "Allow plain-text pastes without an access token")
+	maxPasteSize := flag.Int64("max-paste-size", 1<<20, "Largest plain-text paste in bytes")
+
+	// pasting over SSH, e.g. ssh pastely.internal < file.log
+	sshAddr := flag.String("ssh-addr", "", "SSH network address for pastes, e.g. :2222, empty turns it off")
+	sshHostKey := flag.String("ssh-host-key", "./tls/ssh_host_ed25519_key", "SSH host key file, generated if missing")
+	sshAnonymous := flag.Bool("ssh-anonymous", false, "Accept SSH pastes from unknown keys as anonymous pastes")
+	sshMaxConns := flag.Int("ssh-max-conns", 100, "Open SSH connections allowed, 0 for no limit")
+	sshMaxConnsPerIP := flag.Int("ssh-max-conns-per-ip", 4, "Open SSH connections allowed per IP address, 0 for no limit")
+	sshMaxSessions := flag.Int("ssh-max-sessions", 4, "Sessions an SSH connection may have open at once")
+
+	// anonymous pastes over plain TCP, e.g. cat file.log | nc pastely 9999
+	tcpAddr := flag.String("tcp-addr", "", "TCP network address for netcat pastes, e.g. :9999, empty turns it off")
+	tcpMaxSize := flag.Int64("tcp-max-size", 1<<20, "Largest netcat paste in bytes")
+	tcpIdleTimeout := flag.Duration("tcp-idle-timeout", 10*time.Second, "How long a netcat client may be quiet before its paste is complete")
+	tcpReadTimeout := flag.Duration("tcp-read-timeout", 30*time.Second, "How long a netcat client may take to send its paste")
+	tcpMaxConnsPerIP := flag.Int("tcp-max-conns-per-ip", 4, "Open netcat connections allowed per IP address, 0 for no limit")
+
 	flag.Parse()
 
 	// creating two new Logger. one for INFO and another for ERROR message
@@ -46,6 +169,86 @@ func main() {
 	// error logger
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	switch *secretScan {
+	case secretScanOff, secretScanWarn, secretScanBlock, secretScanRedact:
+	default:
+		errorLog.Fatalf("invalid -secret-scan value %q", *secretScan)
+	}
+
+	var allowedDomains []string
+	switch *registration {
+	case registrationOpen, registrationClosed, registrationInvite:
+	case registrationDomain:
+		for _, domain := range strings.Split(*registrationDomains, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				allowedDomains = append(allowedDomains, domain)
+			}
+		}
+		if len(allowedDomains) == 0 {
+			errorLog.Fatal("-registration=domain needs at least one -registration-domains entry")
+		}
+	default:
+		errorLog.Fatalf("invalid -registration value %q", *registration)
+	}
+
+	// the challenges are signed, so they only need a key that is shared by
+	// all instances. a random one is fine for a single instance
+	var powIssuer *pow.Issuer
+	if *powDifficulty > 0 {
+		key, err := hex.DecodeString(*powKey)
+		if err != nil {
+			errorLog.Fatalf("invalid -pow-key value: %v", err)
+		}
+		if len(key) == 0 {
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				errorLog.Fatal(err)
+			}
+		}
+		powIssuer = &pow.Issuer{
+			Key:           key,
+			Difficulty:    *powDifficulty,
+			MaxDifficulty: max(*powDifficulty, *powMaxDifficulty),
+			LoadThreshold: *powLoadThreshold,
+			TTL:           30 * time.Minute,
+		}
+	}
+
+	// everything pasted with netcat is anonymous
+	if *tcpAddr != "" && !*anonymousPastes {
+		errorLog.Fatal("-tcp-addr needs -anonymous-pastes")
+	}
+	if *sshMaxSessions < 1 {
+		errorLog.Fatal("-ssh-max-sessions must be at least 1")
+	}
+
+	if *passwordAlgo != models.AlgorithmArgon2id && *passwordAlgo != models.AlgorithmBcrypt {
+		errorLog.Fatalf("invalid -password-algo value %q", *passwordAlgo)
+	}
+	// argon2 panics on these instead of returning an error, and the values
+	// would wrap around when they are converted below
+	if *argon2Threads < 1 || *argon2Threads > math.MaxUint8 {
+		errorLog.Fatalf("-argon2-threads must be between 1 and %d", math.MaxUint8)
+	}
+	if *argon2Time < 1 || *argon2Time > math.MaxUint32 {
+		errorLog.Fatal("-argon2-time must be at least 1")
+	}
+	if *argon2Memory < 8*(*argon2Threads) || *argon2Memory > math.MaxUint32 {
+		errorLog.Fatal("-argon2-memory must be at least 8 KiB per thread")
+	}
+	if *bcryptCost < bcrypt.MinCost || *bcryptCost > bcrypt.MaxCost {
+		errorLog.Fatalf("-bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	hasher := &models.PasswordHasher{
+		Algorithm:     *passwordAlgo,
+		BcryptCost:    *bcryptCost,
+		Argon2Memory:  uint32(*argon2Memory),
+		Argon2Time:    uint32(*argon2Time),
+		Argon2Threads: uint8(*argon2Threads),
+		Argon2KeyLen:  32,
+		Argon2SaltLen: 16,
+	}
+
 	// creating a connection pool
 	db, err := openDB(*dsn)
 	if err != nil {
@@ -71,15 +274,99 @@ func main() {
 	// cookie will only be sent over https connection
 	sessionManager.Cookie.Secure = true
 
+	// the password policy, optionally with a list of breached passwords
+	passwordPolicy := &validator.PasswordPolicy{
+		MinLength:  validator.DefaultPasswordPolicy.MinLength,
+		MinEntropy: *minPasswordEntropy,
+	}
+	if *breachedPasswords != "" {
+		passwordPolicy.Breached, err = validator.LoadBreachedPasswords(*breachedPasswords)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		infoLog.Printf("Loaded %d breached password hashes", passwordPolicy.Breached.Len())
+	}
+
+	// choosing the mailer, the file mailer is handy during development
+	var appMailer mailer.Mailer
+	if *mailDir != "" {
+		appMailer = &mailer.FileMailer{Dir: *mailDir, Sender: *smtpSender}
+	} else {
+		appMailer = &mailer.SMTPMailer{
+			Host:     *smtpHost,
+			Port:     *smtpPort,
+			Username: *smtpUsername,
+			Password: *smtpPassword,
+			Sender:   *smtpSender,
+		}
+	}
+
+	// discovering the OpenID Connect provider, if there is one
+	var oidcCfg *oidcConfig
+	if *oidcIssuer != "" {
+		redirectURL := strings.TrimSuffix(*baseURL, "/") + "/user/oidc/callback"
+		oidcCfg, err = newOIDCConfig(context.Background(), *oidcIssuer, *oidcClientID, *oidcClientSecret, redirectURL, *oidcAutoProvision)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// building the chain of login backends
+	users := &models.UserModel{DB: db, Hasher: hasher}
+	var authenticator models.AuthenticatorChain
+	for _, backend := range strings.Split(*authBackends, ",") {
+		switch strings.TrimSpace(backend) {
+		case "local":
+			authenticator = append(authenticator, users)
+		case "ldap":
+			authenticator = append(authenticator, &models.LDAPAuthenticator{
+				URL:          *ldapURL,
+				BindDN:       *ldapBindDN,
+				BindPassword: *ldapBindPassword,
+				BaseDN:       *ldapBaseDN,
+				UserFilter:   *ldapUserFilter,
+				NameAttr:     *ldapNameAttr,
+				EmailAttr:    *ldapEmailAttr,
+				Users:        users,
+				CanProvision: func(email string) bool {
+					return registrationAllows(*registration, allowedDomains, email)
+				},
+			})
+		default:
+			errorLog.Fatalf("invalid -auth-backends value %q", backend)
+		}
+	}
+
 	//creating an instance of application struct
 	app := &application{
-		errorLogger:    errorLog,
-		infoLogger:     infoLog,
-		snippets:       &models.SnippetModel{DB: db},
-		user:           &models.UserModel{DB: db},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
+		errorLogger:         errorLog,
+		infoLogger:          infoLog,
+		snippets:            &models.SnippetModel{DB: db},
+		user:                users,
+		tokens:              &models.TokenModel{DB: db},
+		sessions:            &models.SessionModel{DB: db},
+		reports:             &models.ReportModel{DB: db},
+		templateCache:       templateCache,
+		formDecoder:         formDecoder,
+		sessionManager:      sessionManager,
+		mailer:              appMailer,
+		baseURL:             strings.TrimSuffix(*baseURL, "/"),
+		secretScan:          *secretScan,
+		passwordPolicy:      passwordPolicy,
+		identities:          &models.IdentityModel{DB: db},
+		oidc:                oidcCfg,
+		authenticator:       authenticator,
+		apiTokens:           &models.APITokenModel{DB: db},
+		invites:             &models.InviteModel{DB: db},
+		gists:               &models.GistModel{DB: db},
+		sshKeys:             &models.SSHKeyModel{DB: db},
+		registration:        *registration,
+		registrationDomains: allowedDomains,
+		pow:                 powIssuer,
+		challenges:          &models.ChallengeModel{DB: db},
+		loginAttempts:       &models.LoginAttemptModel{DB: db},
+		anonymousPastes:     *anonymousPastes,
+		maxPasteSize:        *maxPasteSize,
 	}
 
 	// Initialize a tlsConfig struct to hold the non-default TLS settings we
@@ -103,9 +390,112 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	// the SSH server runs next to the HTTP server
+	var sshSrv *sshServer
+	if *sshAddr != "" {
+		hostKey, generated, err := loadSSHHostKey(*sshHostKey)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		if generated {
+			infoLog.Printf("Generated SSH host key %s", *sshHostKey)
+		}
+
+		sshSrv = &sshServer{
+			app:           app,
+			config:        app.sshServerConfig(hostKey, *sshAnonymous),
+			MaxConns:      *sshMaxConns,
+			MaxConnsPerIP: *sshMaxConnsPerIP,
+			MaxSessions:   *sshMaxSessions,
+		}
+
+		sshListener, err := net.Listen("tcp", *sshAddr)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+
+		infoLog.Printf("Starting SSH server on %s", *sshAddr)
+		go func() {
+			err := sshSrv.Serve(sshListener)
+			if !errors.Is(err, net.ErrClosed) {
+				errorLog.Fatal(err)
+			}
+		}()
+	}
+
+	// and so does the netcat listener
+	var tcpServer *tcpPasteServer
+	if *tcpAddr != "" {
+		tcpServer = &tcpPasteServer{
+			app:           app,
+			MaxSize:       *tcpMaxSize,
+			IdleTimeout:   *tcpIdleTimeout,
+			ReadTimeout:   *tcpReadTimeout,
+			MaxConnsPerIP: *tcpMaxConnsPerIP,
+		}
+
+		tcpListener, err := net.Listen("tcp", *tcpAddr)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+
+		infoLog.Printf("Starting netcat listener on %s", *tcpAddr)
+		go func() {
+			err := tcpServer.Serve(tcpListener)
+			if !errors.Is(err, net.ErrClosed) {
+				errorLog.Fatal(err)
+			}
+		}()
+	}
+
+	// on SIGINT or SIGTERM the servers stop accepting connections and finish
+	// the requests and pastes they are working on, all at the same time so
+	// each of them gets the whole timeout
+	shutdownError := make(chan error)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-quit
+
+		infoLog.Printf("Shutting down on %s", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		shutdown := func(name string, f func(context.Context) error) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := f(ctx)
+				if err != nil {
+					errorLog.Printf("%s server: %s", name, err)
+				}
+			}()
+		}
+		if sshSrv != nil {
+			shutdown("SSH", sshSrv.Shutdown)
+		}
+		if tcpServer != nil {
+			shutdown("netcat", tcpServer.Shutdown)
+		}
+
+		err := srv.Shutdown(ctx)
+		wg.Wait()
+		shutdownError <- err
+	}()
+
 	infoLog.Printf("Strating server on port %s", *addr)
 	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errorLog.Fatal(err)
+	if !errors.Is(err, http.ErrServerClosed) {
+		errorLog.Fatal(err)
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	infoLog.Print("Stopped server")
 }
 
 // openDB() function returns a sql.DB connection pool
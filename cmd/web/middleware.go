@@ -1,10 +1,52 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+
+	"al.imran.pastely/internal/models"
 )
 
+// this middleware will load the logged in user on every request and put it in
+// the request context. users that were deleted or disabled are logged out.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := app.sessionManager.GetInt(r.Context(), "authenticationUserId")
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.user.Get(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+
+		// the session outlived the account, so we end it here
+		if user == nil || user.Disabled {
+			err = app.revokeSession(app.sessionManager.Token(r.Context()))
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			err = app.sessionManager.RenewToken(r.Context())
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			app.sessionManager.Remove(r.Context(), "authenticationUserId")
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, contextSetUser(r, user))
+	})
+}
+
 // this middleware will restric unauthenticated user's access
 func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +65,168 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// errInsufficientScope is returned by tokenUser for a token that wasn't
+// granted the needed scope
+var errInsufficientScope = errors.New("insufficient scope")
+
+// tokenUser returns the user of the "Authorization: Bearer" personal access
+// token of the request, or nil if the request has no such header. it returns
+// models.ErrInvalidToken for a missing, unknown or expired token and
+// errInsufficientScope if the token wasn't granted scope. an empty scope
+// accepts any token.
+func (app *application) tokenUser(r *http.Request, scope string) (*models.User, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+
+	plaintext, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, models.ErrInvalidToken
+	}
+	return app.plaintextTokenUser(plaintext, scope)
+}
+
+// plaintextTokenUser is tokenUser for a token that didn't come in the
+// Authorization header
+func (app *application) plaintextTokenUser(plaintext, scope string) (*models.User, error) {
+	token, err := app.apiTokens.Authenticate(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := app.user.Get(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, models.ErrInvalidToken
+	}
+
+	if scope != "" && !token.HasScope(scope) {
+		return nil, errInsufficientScope
+	}
+	return user, nil
+}
+
+// authenticateToken returns a middleware that authenticates requests carrying
+// an "Authorization: Bearer" personal access token, without any session
+// cookie, and only lets them through if the token was granted scope. requests
+// without the header are left to the session based authentication.
+func (app *application) authenticateToken(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := app.tokenUser(r, scope)
+			if err != nil {
+				switch {
+				case errors.Is(err, models.ErrInvalidToken):
+					app.invalidToken(w)
+				case errors.Is(err, errInsufficientScope):
+					w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+					app.clientError(w, http.StatusForbidden)
+				default:
+					app.serverError(w, err)
+				}
+				return
+			}
+			if user == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, contextSetUser(r, user))
+		})
+	}
+}
+
+// apiAuthenticate is authenticateToken for the JSON API, which has no
+// sessions. requests without a token are anonymous and errors are JSON.
+func (app *application) apiAuthenticate(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := app.tokenUser(r, scope)
+			if err != nil {
+				switch {
+				case errors.Is(err, models.ErrInvalidToken):
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					app.errorJSON(w, http.StatusUnauthorized, "invalid or expired access token")
+				case errors.Is(err, errInsufficientScope):
+					w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+					app.errorJSON(w, http.StatusForbidden, "the access token needs the "+scope+" scope")
+				default:
+					app.serverErrorJSON(w, err)
+				}
+				return
+			}
+			if user != nil {
+				r = contextSetUser(r, user)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiRequireAuthentication is requireAuthentication for the JSON API. it
+// must be used after apiAuthenticate.
+func (app *application) apiRequireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := contextGetUser(r)
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.errorJSON(w, http.StatusUnauthorized, "you must use an access token to access this resource")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiRequireVerified is requireVerified for the JSON API. it must be used
+// after apiRequireAuthentication.
+func (app *application) apiRequireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !contextGetUser(r).VerifiedAt.Valid {
+			app.errorJSON(w, http.StatusForbidden, "you must verify your email address to access this resource")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// this middleware will refuse access to users who haven't verified their email
+// address yet. it must be used after requireAuthentication.
+func (app *application) requireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := contextGetUser(r)
+
+		// show the user how to get a new verification email
+		if !user.VerifiedAt.Valid {
+			data := app.newTemplateData(r)
+			app.render(w, http.StatusForbidden, "unverified.tmpl.html", data)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireRole returns a middleware that only lets users with the given role, or
+// a more privileged one, through. it must be used after requireAuthentication.
+func (app *application) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !contextGetUser(r).HasRole(role) {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // this middleware will handle any panic recovery for our program
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
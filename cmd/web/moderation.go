@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/validator"
+)
+
+// how many reports a single IP address may make per hour
+const reportsPerHour = 5
+
+// struct to hold the report form on the snippet page
+type snippetReportForm struct {
+	Reason              string `form:"reason"`
+	validator.Validator `form:"-"`
+}
+
+// Handler for reporting an abusive snippet. logging in isn't required, so
+// reports are rate limited by IP address.
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	if !snippet.CanView(contextGetUserID(r)) {
+		app.notFound(w)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.User = contextGetUser(r)
+
+	// a hidden snippet is already waiting for a moderator, and the form below
+	// must not show its content to anyone else
+	if snippet.Hidden && !data.IsModerator {
+		app.render(w, http.StatusUnavailableForLegalReasons, "hidden.tmpl.html", data)
+		return
+	}
+
+	var form snippetReportForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Reason), "reason", "This field cannot be blank")
+	form.CheckField(validator.MaxCharCount(form.Reason, 500), "reason", "This field cannot contain more than 500 characters")
+
+	err = app.checkProofOfWork(r, &form.Validator)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		data.Form = form
+		app.renderWithChallenge(w, http.StatusUnprocessableEntity, "view.tmpl.html", data)
+		return
+	}
+
+	ip := clientIP(r)
+	count, err := app.reports.CountRecentByIP(ip, time.Now().Add(-time.Hour))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if count >= reportsPerHour {
+		app.clientError(w, http.StatusTooManyRequests)
+		return
+	}
+
+	var reporterID int
+	if user := contextGetUser(r); user != nil {
+		reporterID = user.ID
+	}
+
+	err = app.reports.Insert(snippet.ID, form.Reason, ip, reporterID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks, a moderator will look at your report.")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// Handler for the queue of open reports
+func (app *application) moderationQueue(w http.ResponseWriter, r *http.Request) {
+	reports, err := app.reports.Open()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Reports = reports
+	app.render(w, http.StatusOK, "moderation.tmpl.html", data)
+}
+
+// getReport returns the open report of the id route parameter, writing a
+// response and returning nil if there is none. reports that were already
+// dealt with, e.g. by another moderator, can't be acted on again.
+func (app *application) getReport(w http.ResponseWriter, r *http.Request) *models.Report {
+	id, err := readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return nil
+	}
+
+	report, err := app.reports.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+	if report.Status != "open" {
+		app.sessionManager.Put(r.Context(), "flash", "The report has already been dealt with.")
+		http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+		return nil
+	}
+	return report
+}
+
+// Handler for dismissing a report. a hidden snippet is shown again once no
+// other report on it is open.
+func (app *application) moderationDismissPost(w http.ResponseWriter, r *http.Request) {
+	report := app.getReport(w, r)
+	if report == nil {
+		return
+	}
+
+	err := app.reports.Dismiss(report.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if report.SnippetHidden {
+		open, err := app.reports.CountOpenForSnippet(report.SnippetID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if open == 0 {
+			err = app.snippets.SetHidden(report.SnippetID, false)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The report has been dismissed.")
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+// Handler for hiding a reported snippet while it is being reviewed
+func (app *application) moderationHidePost(w http.ResponseWriter, r *http.Request) {
+	report := app.getReport(w, r)
+	if report == nil {
+		return
+	}
+
+	err := app.snippets.SetHidden(report.SnippetID, true)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The snippet is hidden pending review.")
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+// Handler for deleting a reported snippet and warning its owner by email
+func (app *application) moderationDeletePost(w http.ResponseWriter, r *http.Request) {
+	report := app.getReport(w, r)
+	if report == nil {
+		return
+	}
+
+	// the owner is looked up before the snippet, and with it the report, is gone
+	snippet, err := app.snippets.GetAny(report.SnippetID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	var owner *models.User
+	if snippet.UserID != 0 {
+		owner, err = app.user.Get(snippet.UserID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	err = app.snippets.Delete(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if owner != nil {
+		mailData := map[string]any{
+			"Name":   owner.Name,
+			"ID":     snippet.ID,
+			"Title":  snippet.Title,
+			"Reason": report.Reason,
+		}
+		app.background(func() {
+			err := app.mailer.Send(owner.Email, "snippet_removed.tmpl", mailData)
+			if err != nil {
+				app.errorLogger.Print(err)
+			}
+		})
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The snippet has been deleted.")
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
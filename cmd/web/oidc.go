@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"al.imran.pastely/internal/models"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcConfig holds what we need to log users in with an OpenID Connect
+// identity provider
+type oidcConfig struct {
+	issuer        string
+	oauth2        oauth2.Config
+	verifier      *oidc.IDTokenVerifier
+	autoProvision bool
+}
+
+// newOIDCConfig discovers the provider's endpoints and keys from its issuer URL
+func newOIDCConfig(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, autoProvision bool) (*oidcConfig, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oidcConfig{
+		issuer: issuer,
+		oauth2: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier:      provider.Verifier(&oidc.Config{ClientID: clientID}),
+		autoProvision: autoProvision,
+	}, nil
+}
+
+// the claims of the ID token we care about
+type oidcClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Handler for starting an OIDC login. The state, nonce and PKCE verifier are
+// kept in the session and checked when the provider redirects back.
+func (app *application) userOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	state, err := models.RandomString()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	nonce, err := models.RandomString()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	app.sessionManager.Put(r.Context(), "oidcState", state)
+	app.sessionManager.Put(r.Context(), "oidcNonce", nonce)
+	app.sessionManager.Put(r.Context(), "oidcVerifier", verifier)
+
+	url := app.oidc.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// Handler for the provider redirecting back after the user logged in there
+func (app *application) userOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	// the values are popped so a callback can't be replayed
+	state := app.sessionManager.PopString(r.Context(), "oidcState")
+	nonce := app.sessionManager.PopString(r.Context(), "oidcNonce")
+	verifier := app.sessionManager.PopString(r.Context(), "oidcVerifier")
+
+	query := r.URL.Query()
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// the user cancelled or the provider refused to log them in
+	if query.Get("error") != "" {
+		app.sessionManager.Put(r.Context(), "flash", "Single sign-on failed: "+query.Get("error"))
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	idToken, err := app.oidcIDToken(r.Context(), query.Get("code"), nonce, verifier)
+	if err != nil {
+		app.errorLogger.Print(err)
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var claims oidcClaims
+	err = idToken.Claims(&claims)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	id, err := app.oidcUserID(idToken.Subject, claims)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "There is no account for this identity. Please sign up first.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrAccountDisabled) {
+			app.sessionManager.Put(r.Context(), "flash", "This account has been disabled")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrRegistrationClosed) {
+			app.sessionManager.Put(r.Context(), "flash", "There is no account for this identity and new accounts can't be created.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// oidcIDToken exchanges the code of a callback for the ID token of the user.
+// nonce and verifier are the ones of the login that was started, so a code
+// that was stolen or meant for another login is refused.
+func (app *application) oidcIDToken(ctx context.Context, code, nonce, verifier string) (*oidc.IDToken, error) {
+	token, err := app.oidc.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+
+	idToken, err := app.oidc.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(nonce), []byte(idToken.Nonce)) != 1 {
+		return nil, errors.New("oidc: nonce of the ID token doesn't match")
+	}
+	return idToken, nil
+}
+
+// oidcUserID returns the id of the local user for an external identity. An
+// identity that isn't linked yet is linked to the user with the same email
+// address, if the provider verified it, or to a newly created user if auto
+// provisioning is on and the registration mode allows the address.
+// ErrNoRecord or ErrRegistrationClosed is returned if neither applies.
+func (app *application) oidcUserID(subject string, claims oidcClaims) (int, error) {
+	id, err := app.identities.GetUserID(app.oidc.issuer, subject)
+	if err == nil {
+		return id, app.checkUserEnabled(id)
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		return 0, err
+	}
+
+	// an unverified email could belong to someone else entirely
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, models.ErrNoRecord
+	}
+
+	user, err := app.user.GetByEmail(claims.Email)
+	if err == nil {
+		if user.Disabled {
+			return 0, models.ErrAccountDisabled
+		}
+		id = user.ID
+	} else if errors.Is(err, models.ErrNoRecord) && app.oidc.autoProvision {
+		if !registrationAllows(app.registration, app.registrationDomains, claims.Email) {
+			return 0, models.ErrRegistrationClosed
+		}
+		id, err = app.user.Provision(claims.Name, claims.Email)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		return 0, err
+	}
+
+	err = app.identities.Insert(id, app.oidc.issuer, subject)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// checkUserEnabled returns ErrAccountDisabled if the user's account is disabled
+func (app *application) checkUserEnabled(id int) error {
+	user, err := app.user.Get(id)
+	if err != nil {
+		return err
+	}
+	if user.Disabled {
+		return models.ErrAccountDisabled
+	}
+	return nil
+}
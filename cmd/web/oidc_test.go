@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"golang.org/x/oauth2"
+)
+
+// mockOIDCProvider is an OpenID Connect provider that hands out ID tokens for
+// the codes registered with authorize
+type mockOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockOIDCCode
+}
+
+// what the provider remembers about an authorization code
+type mockOIDCCode struct {
+	challenge string
+	nonce     string
+	audience  string
+	key       *rsa.PrivateKey
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockOIDCProvider{key: key, codes: make(map[string]mockOIDCCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", p.token)
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize registers code as if the user logged in after being sent to the
+// provider with the given PKCE challenge and nonce
+func (p *mockOIDCProvider) authorize(code string, c mockOIDCCode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[code] = c
+}
+
+// token is the token endpoint. like a real provider it refuses a code whose
+// PKCE verifier doesn't match the challenge.
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	p.mu.Lock()
+	c, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || oauth2.S256ChallengeFromVerifier(r.PostForm.Get("code_verifier")) != c.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"invalid_grant"}`)
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   p.URL,
+		"sub":   "user-1",
+		"aud":   c.audience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": c.nonce,
+		"email": "alice@example.com",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signJWT(c.key, claims),
+	})
+}
+
+// signJWT returns claims as a JWT signed with RS256
+func signJWT(key *rsa.PrivateKey, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	hash := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// newOIDCTestApplication returns an application logging in with p
+func newOIDCTestApplication(t *testing.T, p *mockOIDCProvider) *application {
+	cfg, err := newOIDCConfig(context.Background(), p.URL, "pastely", "secret", "https://pastely.test/user/oidc/callback", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApplication()
+	app.sessionManager = scs.New()
+	app.oidc = cfg
+	return app
+}
+
+func TestOIDCIDToken(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	app := newOIDCTestApplication(t, provider)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	challenge := oauth2.S256ChallengeFromVerifier(verifier)
+
+	tests := []struct {
+		name     string
+		code     mockOIDCCode
+		nonce    string
+		verifier string
+		wantErr  bool
+	}{
+		{
+			name:     "Valid",
+			code:     mockOIDCCode{challenge: challenge, nonce: "n1", audience: "pastely", key: provider.key},
+			nonce:    "n1",
+			verifier: verifier,
+		},
+		{
+			name:     "Wrong PKCE verifier",
+			code:     mockOIDCCode{challenge: challenge, nonce: "n1", audience: "pastely", key: provider.key},
+			nonce:    "n1",
+			verifier: oauth2.GenerateVerifier(),
+			wantErr:  true,
+		},
+		{
+			name:     "Missing PKCE verifier",
+			code:     mockOIDCCode{challenge: challenge, nonce: "n1", audience: "pastely", key: provider.key},
+			nonce:    "n1",
+			verifier: "",
+			wantErr:  true,
+		},
+		{
+			name:     "Wrong nonce",
+			code:     mockOIDCCode{challenge: challenge, nonce: "n1", audience: "pastely", key: provider.key},
+			nonce:    "n2",
+			verifier: verifier,
+			wantErr:  true,
+		},
+		{
+			name:     "Missing nonce",
+			code:     mockOIDCCode{challenge: challenge, nonce: "", audience: "pastely", key: provider.key},
+			nonce:    "",
+			verifier: verifier,
+			wantErr:  true,
+		},
+		{
+			name:     "Other audience",
+			code:     mockOIDCCode{challenge: challenge, nonce: "n1", audience: "someone-else", key: provider.key},
+			nonce:    "n1",
+			verifier: verifier,
+			wantErr:  true,
+		},
+		{
+			name:     "Unknown signing key",
+			code:     mockOIDCCode{challenge: challenge, nonce: "n1", audience: "pastely", key: otherKey},
+			nonce:    "n1",
+			verifier: verifier,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider.authorize("code", tt.code)
+
+			idToken, err := app.oidcIDToken(context.Background(), "code", tt.nonce, tt.verifier)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error; want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v; want none", err)
+			}
+			if idToken.Subject != "user-1" {
+				t.Errorf("got subject %q; want %q", idToken.Subject, "user-1")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	app := newOIDCTestApplication(t, provider)
+
+	tests := []struct {
+		name         string
+		sessionState string
+		query        string
+		wantCode     int
+	}{
+		{"No login started", "", "state=abc&code=x", http.StatusBadRequest},
+		{"Missing state", "abc", "code=x", http.StatusBadRequest},
+		{"Wrong state", "abc", "state=abd&code=x", http.StatusBadRequest},
+		{"Provider error", "abc", "state=abc&error=access_denied", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := app.sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.sessionState != "" {
+					app.sessionManager.Put(r.Context(), "oidcState", tt.sessionState)
+				}
+				app.userOIDCCallback(w, r)
+			}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/user/oidc/callback?"+tt.query, nil))
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// the state is popped from the session, so replaying a callback fails
+func TestOIDCCallbackReplay(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	app := newOIDCTestApplication(t, provider)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/oidc/login", app.userOIDCLogin)
+	mux.HandleFunc("/user/oidc/callback", app.userOIDCCallback)
+	handler := app.sessionManager.LoadAndSave(mux)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/user/oidc/login", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusFound)
+	}
+
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), provider.URL+"/authorize") {
+		t.Fatalf("got redirect to %q; want the provider", location)
+	}
+	query := location.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("nonce") == "" {
+		t.Fatalf("got authorization request %q; want PKCE and a nonce", location.RawQuery)
+	}
+	cookie := rr.Result().Cookies()[0]
+
+	callback := "/user/oidc/callback?error=access_denied&state=" + url.QueryEscape(query.Get("state"))
+	for i, want := range []int{http.StatusSeeOther, http.StatusBadRequest} {
+		req := httptest.NewRequest(http.MethodGet, callback, nil)
+		req.AddCookie(cookie)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("callback %d: got status %d; want %d", i+1, rr.Code, want)
+		}
+	}
+}
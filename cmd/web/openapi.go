@@ -0,0 +1,288 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"al.imran.pastely/internal/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// apiDoc describes an operation of the JSON API for the OpenAPI document
+type apiDoc struct {
+	// the name generated clients use for the operation
+	OperationID string
+	Summary     string
+	// the scope the access token needs, and whether a token is needed at all
+	Scope        string
+	AuthRequired bool
+	Query        []apiParam
+	// the name of the schema of the request body, if there is one
+	Body string
+	// the name of the response schema by status code, "" for no body
+	Responses map[int]string
+}
+
+// apiParam is a query parameter of an operation
+type apiParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// apiRouter registers the routes of the JSON API and records them for the
+// OpenAPI document, so the document can't get out of sync with routes()
+type apiRouter struct {
+	router *httprouter.Router
+	paths  map[string]map[string]any
+}
+
+// handle registers handler for method and path, like router.Handler does
+func (a *apiRouter) handle(method, path string, handler http.Handler, doc apiDoc) {
+	a.router.Handler(method, path, handler)
+
+	if a.paths == nil {
+		a.paths = make(map[string]map[string]any)
+	}
+
+	// httprouter's :id becomes {id} in OpenAPI
+	var params []any
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+			params = append(params, map[string]any{
+				"name": name, "in": "path", "required": true,
+				"schema": map[string]any{"type": "integer", "minimum": 1},
+			})
+		}
+	}
+	for _, p := range doc.Query {
+		params = append(params, map[string]any{
+			"name": p.Name, "in": "query", "description": p.Description,
+			"schema": map[string]any{"type": p.Type},
+		})
+	}
+
+	op := map[string]any{
+		"summary":     doc.Summary,
+		"operationId": doc.OperationID,
+		"responses":   apiResponses(doc.Responses),
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if doc.Body != "" {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(doc.Body),
+		}
+	}
+	if doc.Scope != "" || doc.AuthRequired {
+		scopes := []string{}
+		if doc.Scope != "" {
+			op["description"] = "Access tokens need the `" + doc.Scope + "` scope."
+			scopes = append(scopes, doc.Scope)
+		}
+		security := []any{map[string]any{"bearerAuth": scopes}}
+		if !doc.AuthRequired {
+			// an empty requirement means the token is optional
+			security = append(security, map[string]any{})
+		}
+		op["security"] = security
+	}
+
+	openAPIPath := strings.Join(segments, "/")
+	if a.paths[openAPIPath] == nil {
+		a.paths[openAPIPath] = make(map[string]any)
+	}
+	a.paths[openAPIPath][strings.ToLower(method)] = op
+}
+
+// document returns the OpenAPI 3 document of the registered routes
+func (a *apiRouter) document(baseURL string) map[string]any {
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Pastely API",
+			"version":     "1.0.0",
+			"description": "Create and read snippets. Personal access tokens can be created on the account page.",
+		},
+		"servers": []any{map[string]any{"url": baseURL}},
+		"paths":   a.paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+			"schemas": apiSchemas,
+		},
+	}
+}
+
+// apiResponses returns the OpenAPI responses object for the given schemas
+func apiResponses(responses map[int]string) map[string]any {
+	result := make(map[string]any)
+	for code, schema := range responses {
+		response := map[string]any{"description": http.StatusText(code)}
+		if schema != "" {
+			response["content"] = jsonContent(schema)
+		}
+		result[strconv.Itoa(code)] = response
+	}
+	return result
+}
+
+// jsonContent returns an OpenAPI content object referencing schema
+func jsonContent(schema string) map[string]any {
+	return map[string]any{
+		"application/json": map[string]any{
+			"schema": map[string]any{"$ref": "#/components/schemas/" + schema},
+		},
+	}
+}
+
+// apiSchemas are the JSON schemas of the request and response bodies
+var apiSchemas = map[string]any{
+	"Snippet": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":       map[string]any{"type": "integer"},
+			"title":    map[string]any{"type": "string"},
+			"content":  map[string]any{"type": "string"},
+			"created":  map[string]any{"type": "string", "format": "date-time"},
+			"expires":  map[string]any{"type": "string", "format": "date-time"},
+			"owner":    map[string]any{"type": "integer", "description": "The id of the user who created the snippet, left out for anonymous snippets"},
+			"language": map[string]any{"type": "string", "description": "The programming language of the snippet, left out if unknown"},
+			"url":      map[string]any{"type": "string", "format": "uri"},
+		},
+		"required": []string{"id", "title", "content", "created", "expires", "url"},
+	},
+	"SnippetResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"snippet": map[string]any{"$ref": "#/components/schemas/Snippet"},
+		},
+	},
+	"SnippetList": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"snippets": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/Snippet"}},
+			"metadata": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"page":      map[string]any{"type": "integer"},
+					"page_size": map[string]any{"type": "integer"},
+				},
+			},
+		},
+	},
+	"NewSnippet": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"title":           map[string]any{"type": "string", "maxLength": 100},
+			"content":         map[string]any{"type": "string"},
+			"expires":         map[string]any{"type": "integer", "enum": []int{1, 7, 365}, "default": 365, "description": "Days until the snippet expires"},
+			"language":        map[string]any{"type": "string", "maxLength": 50},
+			"confirm_secrets": map[string]any{"type": "boolean", "description": "Publish the snippet even if it looks like it contains secrets"},
+		},
+		"required": []string{"title", "content"},
+	},
+	"SnippetUpdate": map[string]any{
+		"type":        "object",
+		"description": "Fields that are left out are not changed.",
+		"properties": map[string]any{
+			"title":           map[string]any{"type": "string", "maxLength": 100},
+			"content":         map[string]any{"type": "string"},
+			"expires":         map[string]any{"type": "integer", "enum": []int{1, 7, 365}, "description": "Days from now until the snippet expires"},
+			"language":        map[string]any{"type": "string", "maxLength": 50},
+			"confirm_secrets": map[string]any{"type": "boolean"},
+		},
+	},
+	"User": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":       map[string]any{"type": "integer"},
+			"name":     map[string]any{"type": "string"},
+			"email":    map[string]any{"type": "string", "format": "email"},
+			"created":  map[string]any{"type": "string", "format": "date-time"},
+			"verified": map[string]any{"type": "boolean", "description": "Whether the email address has been verified"},
+			"role":     map[string]any{"type": "string", "enum": []string{"user", "moderator", "admin"}},
+		},
+		"required": []string{"id", "name", "email", "created", "verified", "role"},
+	},
+	"UserResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"user": map[string]any{"$ref": "#/components/schemas/User"},
+		},
+	},
+	"UserUpdate": map[string]any{
+		"type":        "object",
+		"description": "Fields that are left out are not changed. A new email address needs the current password and has to be verified again.",
+		"properties": map[string]any{
+			"name":             map[string]any{"type": "string"},
+			"email":            map[string]any{"type": "string", "format": "email"},
+			"current_password": map[string]any{"type": "string", "format": "password", "description": "Required to change the email address"},
+		},
+	},
+	"NewToken": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"email":    map[string]any{"type": "string", "format": "email"},
+			"password": map[string]any{"type": "string", "format": "password"},
+			"name":     map[string]any{"type": "string", "maxLength": 100, "description": "A name to recognise the token by"},
+			"scopes":   map[string]any{"type": "array", "items": map[string]any{"type": "string", "enum": models.AllAPIScopes}, "description": "Defaults to every scope but account:write"},
+			"expires":  map[string]any{"type": "integer", "enum": []int{0, 30, 90, 365}, "default": 90, "description": "Days until the token expires, 0 for never"},
+		},
+		"required": []string{"email", "password", "name"},
+	},
+	"TokenResponse": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"token": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"token":  map[string]any{"type": "string", "description": "The token, it is only shown once"},
+					"name":   map[string]any{"type": "string"},
+					"scopes": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				},
+			},
+		},
+	},
+	"Message": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"message": map[string]any{"type": "string"},
+		},
+	},
+	"Error": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"error": map[string]any{"type": "string"},
+		},
+	},
+	"ValidationError": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"error":  map[string]any{"type": "string"},
+			"fields": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}, "description": "Error messages by field name"},
+		},
+	},
+}
+
+// Handler for the OpenAPI document
+func (app *application) openAPIDocument(doc map[string]any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := app.writeJSON(w, http.StatusOK, doc, nil)
+		if err != nil {
+			app.serverErrorJSON(w, err)
+		}
+	}
+}
+
+// Handler for the page to explore the API, the page loads the document itself
+func (app *application) apiExplorer(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	app.render(w, http.StatusOK, "api.tmpl.html", data)
+}
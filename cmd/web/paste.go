@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/paste"
+	"al.imran.pastely/internal/validator"
+)
+
+// the form fields of a multipart paste that are options, not content
+var pasteOptionFields = []string{"title", "expires", "lang", "confirm_secrets"}
+
+// Handler for plain-text pastes, the way termbin and sprunge work:
+//
+//	curl --data-binary @file https://pastely/
+//	curl -F 'f=@file' https://pastely/
+//
+// the title, expiry and language are taken from the title, expires and lang
+// query parameters or the X-Title, X-Expires and X-Language headers. the
+// response is just the URL of the snippet.
+func (app *application) pastePost(w http.ResponseWriter, r *http.Request) {
+	user := contextGetUser(r)
+	if user == nil && !app.anonymousPastes {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Anonymous pastes are disabled, send an access token with \"Authorization: Bearer <token>\"", http.StatusUnauthorized)
+		return
+	}
+	if user != nil && !user.VerifiedAt.Valid {
+		http.Error(w, "Please verify your email address before pasting", http.StatusForbidden)
+		return
+	}
+
+	content, filename, err := app.readPaste(w, r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, fmt.Sprintf("Pastes cannot be larger than %d bytes", app.maxPasteSize), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	option := func(name, header string) string {
+		if value := r.URL.Query().Get(name); value != "" {
+			return value
+		}
+		if value := r.Header.Get(header); value != "" {
+			return value
+		}
+		if r.MultipartForm != nil && len(r.MultipartForm.Value[name]) > 0 {
+			return r.MultipartForm.Value[name][0]
+		}
+		return ""
+	}
+
+	form := snippetCreateForm{
+		Title:    option("title", "X-Title"),
+		Content:  content,
+		Language: option("lang", "X-Language"),
+	}
+	if form.Title == "" {
+		form.Title = filename
+	}
+	if form.Title == "" {
+		form.Title = paste.DefaultTitle(content)
+	}
+	form.ConfirmSecrets, _ = strconv.ParseBool(option("confirm_secrets", "X-Confirm-Secrets"))
+
+	form.Expires = 365
+	if expires := option("expires", "X-Expires"); expires != "" {
+		form.Expires, err = paste.ParseDays(expires)
+		form.CheckField(err == nil && form.Expires <= 365, "expires", "This field must be between 1 day and 1 year, e.g. 1d, 7d or 1y")
+	}
+	form.CheckField(utf8.ValidString(content), "content", "This field must be text, binary files cannot be pasted")
+	app.validateSnippet(&form)
+
+	if !form.Valid() {
+		message := pasteErrors(form.Validator)
+		if len(form.SecretKinds) > 0 && !form.ConfirmSecrets {
+			message += "\nSend confirm_secrets=1 to publish it anyway."
+		}
+		http.Error(w, message, http.StatusUnprocessableEntity)
+		return
+	}
+
+	var userID int
+	if user != nil {
+		userID = user.ID
+	}
+
+	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires, userID, form.Language, models.VisibilityPublic)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	url := fmt.Sprintf("%s/snippet/view/%d", app.baseURL, id)
+	w.Header().Set("Location", url)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(w, url)
+}
+
+// readPaste returns the content of a paste and the name of the file it came
+// from, if any. multipart forms carry the content in their first file, or in
+// their first field that isn't an option. any other body is the content.
+func (app *application) readPaste(w http.ResponseWriter, r *http.Request) (string, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != "multipart/form-data" {
+		r.Body = http.MaxBytesReader(w, r.Body, app.maxPasteSize)
+		content, err := io.ReadAll(r.Body)
+		return string(content), "", err
+	}
+
+	// leave some room for the headers of the parts
+	r.Body = http.MaxBytesReader(w, r.Body, app.maxPasteSize+64*1024)
+	err := r.ParseMultipartForm(app.maxPasteSize)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the fields of the form are sorted, so the result doesn't change
+	// between requests, but f comes first as that's what termbin uses
+	sorted := func(names []string) []string {
+		slices.Sort(names)
+		if i := slices.Index(names, "f"); i > 0 {
+			names = slices.Insert(slices.Delete(names, i, i+1), 0, "f")
+		}
+		return names
+	}
+
+	for _, name := range sorted(slices.Collect(maps.Keys(r.MultipartForm.File))) {
+		header := r.MultipartForm.File[name][0]
+		if header.Size > app.maxPasteSize {
+			return "", "", &http.MaxBytesError{Limit: app.maxPasteSize}
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			return "", "", err
+		}
+		defer file.Close()
+
+		content, err := io.ReadAll(file)
+		return string(content), header.Filename, err
+	}
+
+	for _, name := range sorted(slices.Collect(maps.Keys(r.MultipartForm.Value))) {
+		if !slices.Contains(pasteOptionFields, name) {
+			return r.MultipartForm.Value[name][0], "", nil
+		}
+	}
+	return "", "", errors.New("The form does not contain anything to paste")
+}
+
+// createPaste validates and stores a paste that only has content, and maybe
+// a title, with the default expiry. if the paste is invalid it returns the
+// errors as text instead. SSH and netcat clients have no way to confirm
+// secrets, so with -secret-scan=warn the paste is stored anyway and a warning
+// is returned with it.
+func (app *application) createPaste(title, content string, userID int) (id int, warning, errs string, err error) {
+	form := snippetCreateForm{
+		Title:          strings.TrimSpace(title),
+		Content:        content,
+		Expires:        365,
+		ConfirmSecrets: true,
+	}
+	if form.Title == "" {
+		form.Title = paste.DefaultTitle(content)
+	}
+	form.CheckField(utf8.ValidString(content), "content", "This field must be text, binary files cannot be pasted")
+	app.validateSnippet(&form)
+
+	if !form.Valid() {
+		return 0, "", pasteErrors(form.Validator), nil
+	}
+	if app.secretScan == secretScanWarn && len(form.SecretKinds) > 0 {
+		warning = "Warning: this paste looks like it contains secrets: " + strings.Join(form.SecretKinds, ", ")
+	}
+
+	id, err = app.snippets.Insert(form.Title, form.Content, form.Expires, userID, "", models.VisibilityPublic)
+	return id, warning, "", err
+}
+
+// pasteErrors formats the errors of a validator as plain text, one per line
+func pasteErrors(v validator.Validator) string {
+	lines := slices.Clone(v.NonFieldErrors)
+	for _, field := range []string{"title", "content", "expires", "lang", "language"} {
+		if message, ok := v.FieldErrors[field]; ok {
+			lines = append(lines, field+": "+message)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
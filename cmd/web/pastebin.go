@@ -0,0 +1,447 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/paste"
+)
+
+// The pastebin.com API, for editor plugins and bots that can't speak anything
+// else. api_dev_key is a personal access token and so is api_user_key, which
+// api_login.php hands out. see https://pastebin.com/doc_api
+
+// the form fields of the pastebin.com API
+type pastebinForm struct {
+	DevKey          string `form:"api_dev_key"`
+	UserKey         string `form:"api_user_key"`
+	Option          string `form:"api_option"`
+	PasteCode       string `form:"api_paste_code"`
+	PasteName       string `form:"api_paste_name"`
+	PasteFormat     string `form:"api_paste_format"`
+	PastePrivate    string `form:"api_paste_private"`
+	PasteExpireDate string `form:"api_paste_expire_date"`
+	PasteKey        string `form:"api_paste_key"`
+	ConfirmSecrets  bool   `form:"api_paste_confirm_secrets"` // not part of the pastebin.com API
+	ResultsLimit    int    `form:"api_results_limit"`
+	UserName        string `form:"api_user_name"`
+	UserPassword    string `form:"api_user_password"`
+}
+
+// api_paste_private is the index of the visibility
+var pastebinVisibility = []string{models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate}
+
+// days until a snippet expires by api_paste_expire_date. snippets live for
+// whole days and a year at most, so shorter expiries are rounded up and
+// never (N) becomes a year.
+var pastebinExpiry = map[string]int{
+	"": 365, "N": 365, "10M": 1, "1H": 1, "1D": 1, "1W": 7, "2W": 14, "1M": 30, "6M": 182, "1Y": 365,
+}
+
+// a paste in the XML of api_option=list
+type pastebinPaste struct {
+	XMLName     xml.Name `xml:"paste"`
+	Key         string   `xml:"paste_key"`
+	Date        int64    `xml:"paste_date"`
+	Title       string   `xml:"paste_title"`
+	Size        int      `xml:"paste_size"`
+	ExpireDate  int64    `xml:"paste_expire_date"`
+	Private     int      `xml:"paste_private"`
+	FormatLong  string   `xml:"paste_format_long"`
+	FormatShort string   `xml:"paste_format_short"`
+	URL         string   `xml:"paste_url"`
+	Hits        int      `xml:"paste_hits"`
+}
+
+// the user in the XML of api_option=userdetails
+type pastebinUser struct {
+	XMLName     xml.Name `xml:"user"`
+	Name        string   `xml:"user_name"`
+	FormatShort string   `xml:"user_format_short"`
+	Expiration  string   `xml:"user_expiration"`
+	AvatarURL   string   `xml:"user_avatar_url"`
+	Private     int      `xml:"user_private"`
+	Website     string   `xml:"user_website"`
+	Email       string   `xml:"user_email"`
+	Location    string   `xml:"user_location"`
+	AccountType int      `xml:"user_account_type"`
+}
+
+// pastebinError sends an error the way pastebin.com does, as text starting
+// with "Bad API request", which is what clients look for
+func pastebinError(w http.ResponseWriter, status int, message string) {
+	http.Error(w, "Bad API request, "+message, status)
+}
+
+// pastebinWrite sends a successful response
+func pastebinWrite(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// decodePastebinForm decodes the form of a request to the pastebin.com API.
+// on failure it sends an error and returns false.
+func (app *application) decodePastebinForm(w http.ResponseWriter, r *http.Request, form *pastebinForm) bool {
+	// leave some room for the fields other than the paste
+	r.Body = http.MaxBytesReader(w, r.Body, app.maxPasteSize+64*1024)
+
+	err := app.decodePostForm(r, form)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			pastebinError(w, http.StatusRequestEntityTooLarge, "maximum paste file size exceeded")
+		} else {
+			pastebinError(w, http.StatusBadRequest, "invalid form")
+		}
+		return false
+	}
+	return true
+}
+
+// pastebinUsers returns the owner of the api_dev_key of the form and the user
+// of the api_user_key, or nil if there is no api_user_key. both keys must be
+// granted scope. on failure it sends an error and returns false.
+func (app *application) pastebinUsers(w http.ResponseWriter, r *http.Request, form *pastebinForm, scope string) (*models.User, *models.User, bool) {
+	dev, err := app.plaintextTokenUser(form.DevKey, scope)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidToken), errors.Is(err, models.ErrNoRecord):
+			pastebinError(w, http.StatusUnauthorized, "invalid api_dev_key")
+		case errors.Is(err, errInsufficientScope):
+			pastebinError(w, http.StatusForbidden, "the api_dev_key needs the "+scope+" scope")
+		default:
+			app.serverError(w, err)
+		}
+		return nil, nil, false
+	}
+
+	if form.UserKey == "" {
+		return dev, nil, true
+	}
+
+	user, err := app.plaintextTokenUser(form.UserKey, scope)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidToken), errors.Is(err, models.ErrNoRecord):
+			pastebinError(w, http.StatusUnauthorized, "invalid api_user_key")
+		case errors.Is(err, errInsufficientScope):
+			pastebinError(w, http.StatusForbidden, "the api_user_key needs the "+scope+" scope")
+		default:
+			app.serverError(w, err)
+		}
+		return nil, nil, false
+	}
+	return dev, user, true
+}
+
+// Handler for api_post.php, which creates, lists and deletes pastes
+func (app *application) pastebinPost(w http.ResponseWriter, r *http.Request) {
+	var form pastebinForm
+	if !app.decodePastebinForm(w, r, &form) {
+		return
+	}
+
+	switch form.Option {
+	case "paste":
+		app.pastebinPaste(w, r, &form)
+	case "list":
+		app.pastebinList(w, r, &form)
+	case "delete":
+		app.pastebinDelete(w, r, &form)
+	case "userdetails":
+		app.pastebinUserDetails(w, r, &form)
+	default:
+		pastebinError(w, http.StatusBadRequest, "invalid api_option")
+	}
+}
+
+// pastebinPaste creates a paste, owned by the user of the api_user_key or by
+// the owner of the api_dev_key without one, so they can list and delete it.
+// a paste that looks like it contains secrets is only published with
+// api_paste_confirm_secrets or an X-Confirm-Secrets header.
+func (app *application) pastebinPaste(w http.ResponseWriter, r *http.Request, form *pastebinForm) {
+	dev, user, ok := app.pastebinUsers(w, r, form, models.ScopeSnippetsWrite)
+	if !ok {
+		return
+	}
+
+	owner := dev
+	if user != nil {
+		owner = user
+	}
+	if !owner.VerifiedAt.Valid {
+		pastebinError(w, http.StatusForbidden, "the account has to verify its email address first")
+		return
+	}
+
+	private := 0
+	if form.PastePrivate != "" {
+		var err error
+		private, err = strconv.Atoi(form.PastePrivate)
+		// only users can have private pastes
+		if err != nil || private < 0 || private > 2 || (private == 2 && user == nil) {
+			pastebinError(w, http.StatusUnprocessableEntity, "invalid api_paste_private")
+			return
+		}
+	}
+
+	expires, ok := pastebinExpiry[form.PasteExpireDate]
+	if !ok {
+		pastebinError(w, http.StatusUnprocessableEntity, "invalid api_paste_expire_date")
+		return
+	}
+
+	if form.PasteCode == "" {
+		pastebinError(w, http.StatusUnprocessableEntity, "api_paste_code was empty")
+		return
+	}
+
+	snippet := snippetCreateForm{
+		Title:          form.PasteName,
+		Content:        form.PasteCode,
+		Expires:        expires,
+		Language:       form.PasteFormat,
+		ConfirmSecrets: form.ConfirmSecrets,
+	}
+	if confirm, err := strconv.ParseBool(r.Header.Get("X-Confirm-Secrets")); err == nil && confirm {
+		snippet.ConfirmSecrets = true
+	}
+	if snippet.Title == "" {
+		snippet.Title = paste.DefaultTitle(snippet.Content)
+	}
+	if snippet.Language == "text" {
+		snippet.Language = ""
+	}
+	app.validateSnippet(&snippet)
+
+	if !snippet.Valid() {
+		message := pasteErrors(snippet.Validator)
+		if len(snippet.SecretKinds) > 0 && !snippet.ConfirmSecrets {
+			message += "\nSend api_paste_confirm_secrets=1 to publish it anyway."
+		}
+		pastebinError(w, http.StatusUnprocessableEntity, message)
+		return
+	}
+
+	id, err := app.snippets.Insert(snippet.Title, snippet.Content, snippet.Expires, owner.ID, snippet.Language, pastebinVisibility[private])
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	url := fmt.Sprintf("%s/snippet/view/%d", app.baseURL, id)
+	pastebinWrite(w, "text/plain; charset=utf-8", []byte(url))
+}
+
+// pastebinList lists the pastes of the user of the api_user_key
+func (app *application) pastebinList(w http.ResponseWriter, r *http.Request, form *pastebinForm) {
+	_, user, ok := app.pastebinUsers(w, r, form, models.ScopeSnippetsRead)
+	if !ok {
+		return
+	}
+	if user == nil {
+		pastebinError(w, http.StatusUnauthorized, "invalid api_user_key")
+		return
+	}
+
+	limit := form.ResultsLimit
+	if limit == 0 {
+		limit = 50
+	}
+	if limit < 1 || limit > 1000 {
+		pastebinError(w, http.StatusUnprocessableEntity, "invalid api_results_limit")
+		return
+	}
+
+	snippets, err := app.snippets.List(user.ID, limit, 0)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if len(snippets) == 0 {
+		pastebinWrite(w, "text/plain; charset=utf-8", []byte("No pastes found."))
+		return
+	}
+
+	pastes := make([]pastebinPaste, 0, len(snippets))
+	for _, s := range snippets {
+		format := s.Language
+		if format == "" {
+			format = "text"
+		}
+		pastes = append(pastes, pastebinPaste{
+			Key:         strconv.Itoa(s.ID),
+			Date:        s.Created.Unix(),
+			Title:       s.Title,
+			Size:        len(s.Content),
+			ExpireDate:  s.Expires.Unix(),
+			Private:     slices.Index(pastebinVisibility, s.Visibility),
+			FormatLong:  format,
+			FormatShort: format,
+			URL:         fmt.Sprintf("%s/snippet/view/%d", app.baseURL, s.ID),
+		})
+	}
+
+	body, err := xml.MarshalIndent(pastes, "", "\t")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	pastebinWrite(w, "text/xml; charset=utf-8", body)
+}
+
+// pastebinDelete deletes a paste of the user of the api_user_key
+func (app *application) pastebinDelete(w http.ResponseWriter, r *http.Request, form *pastebinForm) {
+	_, user, ok := app.pastebinUsers(w, r, form, models.ScopeSnippetsDelete)
+	if !ok {
+		return
+	}
+	if user == nil {
+		pastebinError(w, http.StatusUnauthorized, "invalid api_user_key")
+		return
+	}
+
+	snippet := app.pastebinOwnSnippet(w, form.PasteKey, user, "invalid permission to remove paste")
+	if snippet == nil {
+		return
+	}
+
+	err := app.snippets.Delete(snippet.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	pastebinWrite(w, "text/plain; charset=utf-8", []byte("Paste Removed"))
+}
+
+// pastebinUserDetails describes the user of the api_user_key
+func (app *application) pastebinUserDetails(w http.ResponseWriter, r *http.Request, form *pastebinForm) {
+	_, user, ok := app.pastebinUsers(w, r, form, "")
+	if !ok {
+		return
+	}
+	if user == nil {
+		pastebinError(w, http.StatusUnauthorized, "invalid api_user_key")
+		return
+	}
+
+	body, err := xml.MarshalIndent(pastebinUser{
+		Name:        user.Name,
+		FormatShort: "text",
+		Expiration:  "N",
+		Email:       user.Email,
+	}, "", "\t")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	pastebinWrite(w, "text/xml; charset=utf-8", body)
+}
+
+// pastebinOwnSnippet returns the snippet with the given api_paste_key if it
+// belongs to user. otherwise it sends an error with message and returns nil.
+func (app *application) pastebinOwnSnippet(w http.ResponseWriter, key string, user *models.User, message string) *models.Snippet {
+	id, err := strconv.Atoi(key)
+	if err != nil || id < 1 {
+		pastebinError(w, http.StatusNotFound, message)
+		return nil
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			pastebinError(w, http.StatusNotFound, message)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	// we don't tell other users that the snippet exists
+	if snippet.UserID != user.ID {
+		pastebinError(w, http.StatusNotFound, message)
+		return nil
+	}
+	return snippet
+}
+
+// Handler for api_raw.php, which returns the content of a paste of the user
+// of the api_user_key, including private ones
+func (app *application) pastebinRaw(w http.ResponseWriter, r *http.Request) {
+	var form pastebinForm
+	if !app.decodePastebinForm(w, r, &form) {
+		return
+	}
+	if form.Option != "show_paste" {
+		pastebinError(w, http.StatusBadRequest, "invalid api_option")
+		return
+	}
+
+	_, user, ok := app.pastebinUsers(w, r, &form, models.ScopeSnippetsRead)
+	if !ok {
+		return
+	}
+	if user == nil {
+		pastebinError(w, http.StatusUnauthorized, "invalid api_user_key")
+		return
+	}
+
+	snippet := app.pastebinOwnSnippet(w, form.PasteKey, user, "invalid permission to view this paste or invalid api_paste_key")
+	if snippet == nil {
+		return
+	}
+
+	// like snippetView, only moderators can see hidden snippets, not even
+	// their owner
+	if snippet.Hidden && !user.HasRole(models.RoleModerator) {
+		pastebinError(w, http.StatusUnavailableForLegalReasons, "this paste has been hidden pending review")
+		return
+	}
+	pastebinWrite(w, "text/plain; charset=utf-8", []byte(snippet.Content))
+}
+
+// how long an api_user_key from api_login.php is valid
+const pastebinUserKeyTTL = 30 * 24 * time.Hour
+
+// Handler for api_login.php, which logs in with an email address as
+// api_user_name and returns a new personal access token as the api_user_key.
+// the token can only manage snippets and shows up among the tokens on the
+// account page, where it can be revoked.
+func (app *application) pastebinLogin(w http.ResponseWriter, r *http.Request) {
+	var form pastebinForm
+	if !app.decodePastebinForm(w, r, &form) {
+		return
+	}
+
+	_, _, ok := app.pastebinUsers(w, r, &form, "")
+	if !ok {
+		return
+	}
+
+	id, err := app.checkLogin(r, form.UserName, form.UserPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredential) {
+			pastebinError(w, http.StatusUnauthorized, "invalid login")
+		} else if errors.Is(err, errTooManyLogins) {
+			pastebinError(w, http.StatusTooManyRequests, "too many failed logins, please try again later")
+		} else if errors.Is(err, models.ErrAccountDisabled) || errors.Is(err, models.ErrRegistrationClosed) {
+			pastebinError(w, http.StatusForbidden, "account not active")
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	token, err := app.apiTokens.Insert(id, "pastebin API login", models.DefaultAPIScopes, pastebinUserKeyTTL)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	pastebinWrite(w, "text/plain; charset=utf-8", []byte(token))
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
+	"al.imran.pastely/internal/models"
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 )
@@ -11,29 +13,204 @@ import (
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
-	// same error for all the NotFound request
+	// same error for all the NotFound request, in JSON for the API. links of
+	// the hastebin API are redirected to the snippet.
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			app.notFoundJSON(w)
+			return
+		}
+		if url, ok := hastebinRedirect(r); ok {
+			http.Redirect(w, r, url, http.StatusFound)
+			return
+		}
 		app.notFound(w)
 	})
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			app.errorJSON(w, http.StatusMethodNotAllowed, "the "+r.Method+" method is not supported for this resource")
+			return
+		}
+		app.clientError(w, http.StatusMethodNotAllowed)
+	})
 
 	fileServer := http.FileServer(http.Dir("./ui/static/"))
 	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
 
 	// creating a dynamic middleware that contain middleware specific to dynamic application routes
-	dynamic := alice.New(app.sessionManager.LoadAndSave)
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.authenticate)
 
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodPost, "/snippet/report/:id", dynamic.ThenFunc(app.snippetReportPost))
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
 	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	if app.oidc != nil {
+		router.Handler(http.MethodGet, "/user/oidc/login", dynamic.ThenFunc(app.userOIDCLogin))
+		router.Handler(http.MethodGet, "/user/oidc/callback", dynamic.ThenFunc(app.userOIDCCallback))
+	}
+	router.Handler(http.MethodGet, "/user/password/forgot", dynamic.ThenFunc(app.passwordForgot))
+	router.Handler(http.MethodPost, "/user/password/forgot", dynamic.ThenFunc(app.passwordForgotPost))
+	router.Handler(http.MethodGet, "/user/password/reset", dynamic.ThenFunc(app.passwordReset))
+	router.Handler(http.MethodPost, "/user/password/reset", dynamic.ThenFunc(app.passwordResetPost))
+	router.Handler(http.MethodGet, "/user/verify", dynamic.ThenFunc(app.userVerify))
+	router.Handler(http.MethodPost, "/user/verify", dynamic.ThenFunc(app.userVerifyPost))
 
 	// protected middleware chain
 	protected := dynamic.Append(app.requireAuthentication)
-	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodPost, "/user/verify/resend", protected.ThenFunc(app.userVerifyResendPost))
+	router.Handler(http.MethodGet, "/account", protected.ThenFunc(app.accountView))
+	router.Handler(http.MethodGet, "/account/password", protected.ThenFunc(app.accountPassword))
+	router.Handler(http.MethodPost, "/account/password", protected.ThenFunc(app.accountPasswordPost))
+	router.Handler(http.MethodGet, "/account/profile", protected.ThenFunc(app.accountProfile))
+	router.Handler(http.MethodPost, "/account/profile", protected.ThenFunc(app.accountProfilePost))
+	router.Handler(http.MethodGet, "/account/sessions", protected.ThenFunc(app.accountSessions))
+	router.Handler(http.MethodPost, "/account/sessions/revoke", protected.ThenFunc(app.accountSessionRevokePost))
+	router.Handler(http.MethodPost, "/account/sessions/revoke-others", protected.ThenFunc(app.accountSessionsRevokeOthersPost))
+	router.Handler(http.MethodGet, "/account/tokens", protected.ThenFunc(app.accountTokens))
+	router.Handler(http.MethodPost, "/account/tokens", protected.ThenFunc(app.accountTokenCreatePost))
+	router.Handler(http.MethodPost, "/account/tokens/revoke", protected.ThenFunc(app.accountTokenRevokePost))
+	router.Handler(http.MethodGet, "/account/ssh-keys", protected.ThenFunc(app.accountSSHKeys))
+	router.Handler(http.MethodPost, "/account/ssh-keys", protected.ThenFunc(app.accountSSHKeyCreatePost))
+	router.Handler(http.MethodPost, "/account/ssh-keys/delete", protected.ThenFunc(app.accountSSHKeyDeletePost))
+	router.Handler(http.MethodGet, "/account/delete", protected.ThenFunc(app.accountDelete))
+	router.Handler(http.MethodPost, "/account/delete", protected.ThenFunc(app.accountDeletePost))
+
+	// verified middleware chain, for users who confirmed their email address
+	verified := protected.Append(app.requireVerified)
+	router.Handler(http.MethodGet, "/snippet/create", verified.ThenFunc(app.snippetCreate))
+
+	// routes that also accept a personal access token with the given scope
+	// instead of a session
+	writable := dynamic.Append(app.authenticateToken(models.ScopeSnippetsWrite), app.requireAuthentication, app.requireVerified)
+	router.Handler(http.MethodPost, "/snippet/create", writable.ThenFunc(app.snippetCreatePost))
+	deletable := dynamic.Append(app.authenticateToken(models.ScopeSnippetsDelete), app.requireAuthentication)
+	router.Handler(http.MethodPost, "/snippet/delete/:id", deletable.ThenFunc(app.snippetDeletePost))
+
+	// plain-text pastes for curl and the hastebin API, anonymous unless a
+	// token is sent
+	pasting := alice.New(app.authenticateToken(models.ScopeSnippetsWrite))
+	router.Handler(http.MethodPost, "/", pasting.ThenFunc(app.pastePost))
+	router.Handler(http.MethodPost, "/documents", pasting.ThenFunc(app.hastebinCreate))
+	router.Handler(http.MethodGet, "/documents/:key", http.HandlerFunc(app.hastebinView))
+	router.Handler(http.MethodGet, "/raw/:key", http.HandlerFunc(app.hastebinRaw))
+
+	// the JSON API has no sessions, it only knows personal access tokens.
+	// reading works without a token as well. the routes are registered
+	// through api so they show up in the OpenAPI document.
+	api := &apiRouter{router: router}
+	apiRead := alice.New(app.apiAuthenticate(models.ScopeSnippetsRead))
+	api.handle(http.MethodGet, "/api/v1/snippets", apiRead.ThenFunc(app.apiSnippetList), apiDoc{
+		OperationID: "listSnippets",
+		Summary:     "List the latest snippets",
+		Scope:       models.ScopeSnippetsRead,
+		Query: []apiParam{
+			{Name: "page", Type: "integer", Description: "Page number, from 1 to 21474836"},
+			{Name: "page_size", Type: "integer", Description: "Snippets per page, at most 100"},
+			{Name: "mine", Type: "boolean", Description: "Only list the snippets of the token owner"},
+		},
+		Responses: map[int]string{200: "SnippetList", 401: "Error", 422: "ValidationError"},
+	})
+	api.handle(http.MethodGet, "/api/v1/snippets/:id", apiRead.ThenFunc(app.apiSnippetView), apiDoc{
+		OperationID: "getSnippet",
+		Summary:     "Get a snippet",
+		Scope:       models.ScopeSnippetsRead,
+		Responses:   map[int]string{200: "SnippetResponse", 404: "Error", 451: "Error"},
+	})
+	apiWrite := alice.New(app.apiAuthenticate(models.ScopeSnippetsWrite), app.apiRequireAuthentication, app.apiRequireVerified)
+	api.handle(http.MethodPost, "/api/v1/snippets", apiWrite.ThenFunc(app.apiSnippetCreate), apiDoc{
+		OperationID:  "createSnippet",
+		Summary:      "Create a snippet",
+		Scope:        models.ScopeSnippetsWrite,
+		AuthRequired: true,
+		Body:         "NewSnippet",
+		Responses:    map[int]string{201: "SnippetResponse", 400: "Error", 401: "Error", 403: "Error", 422: "ValidationError"},
+	})
+	api.handle(http.MethodPatch, "/api/v1/snippets/:id", apiWrite.ThenFunc(app.apiSnippetUpdate), apiDoc{
+		OperationID:  "updateSnippet",
+		Summary:      "Update one of your snippets",
+		Scope:        models.ScopeSnippetsWrite,
+		AuthRequired: true,
+		Body:         "SnippetUpdate",
+		Responses:    map[int]string{200: "SnippetResponse", 400: "Error", 401: "Error", 403: "Error", 404: "Error", 422: "ValidationError", 451: "Error"},
+	})
+	apiDelete := alice.New(app.apiAuthenticate(models.ScopeSnippetsDelete), app.apiRequireAuthentication)
+	api.handle(http.MethodDelete, "/api/v1/snippets/:id", apiDelete.ThenFunc(app.apiSnippetDelete), apiDoc{
+		OperationID:  "deleteSnippet",
+		Summary:      "Delete one of your snippets",
+		Scope:        models.ScopeSnippetsDelete,
+		AuthRequired: true,
+		Responses:    map[int]string{200: "Message", 401: "Error", 403: "Error", 404: "Error"},
+	})
+
+	apiAccount := alice.New(app.apiAuthenticate(""), app.apiRequireAuthentication)
+	api.handle(http.MethodGet, "/api/v1/users/me", apiAccount.ThenFunc(app.apiUserView), apiDoc{
+		OperationID:  "getCurrentUser",
+		Summary:      "Get the owner of the access token",
+		AuthRequired: true,
+		Responses:    map[int]string{200: "UserResponse", 401: "Error"},
+	})
+	apiAccountWrite := alice.New(app.apiAuthenticate(models.ScopeAccountWrite), app.apiRequireAuthentication)
+	api.handle(http.MethodPatch, "/api/v1/users/me", apiAccountWrite.ThenFunc(app.apiUserUpdate), apiDoc{
+		OperationID:  "updateCurrentUser",
+		Summary:      "Change the name or email of the owner of the access token",
+		Scope:        models.ScopeAccountWrite,
+		AuthRequired: true,
+		Body:         "UserUpdate",
+		Responses:    map[int]string{200: "UserResponse", 400: "Error", 401: "Error", 403: "Error", 409: "Error", 422: "ValidationError"},
+	})
+	api.handle(http.MethodPost, "/api/v1/tokens", http.HandlerFunc(app.apiTokenCreate), apiDoc{
+		OperationID: "createToken",
+		Summary:     "Create an access token with an email and password",
+		Body:        "NewToken",
+		Responses:   map[int]string{201: "TokenResponse", 400: "Error", 401: "Error", 403: "Error", 422: "ValidationError", 429: "Error"},
+	})
+
+	// the pastebin.com API, for clients that only know that one
+	router.Handler(http.MethodPost, "/api/api_post.php", http.HandlerFunc(app.pastebinPost))
+	router.Handler(http.MethodPost, "/api/api_login.php", http.HandlerFunc(app.pastebinLogin))
+	router.Handler(http.MethodPost, "/api/api_raw.php", http.HandlerFunc(app.pastebinRaw))
+
+	// the GitHub Gist API, also under /api/v3 where clients look for GitHub
+	// Enterprise
+	gistRead := alice.New(app.gistAuthenticate(models.ScopeSnippetsRead))
+	gistWrite := alice.New(app.gistAuthenticate(models.ScopeSnippetsWrite))
+	gistDelete := alice.New(app.gistAuthenticate(models.ScopeSnippetsDelete))
+	for _, prefix := range []string{"", "/api/v3"} {
+		router.Handler(http.MethodGet, prefix+"/gists", gistRead.ThenFunc(app.gistList))
+		router.Handler(http.MethodPost, prefix+"/gists", gistWrite.ThenFunc(app.gistCreate))
+		router.Handler(http.MethodGet, prefix+"/gists/:id", gistRead.ThenFunc(app.gistView))
+		router.Handler(http.MethodPatch, prefix+"/gists/:id", gistWrite.ThenFunc(app.gistUpdate))
+		router.Handler(http.MethodDelete, prefix+"/gists/:id", gistDelete.ThenFunc(app.gistDelete))
+		router.Handler(http.MethodGet, prefix+"/users/:id/gists", gistRead.ThenFunc(app.gistListForUser))
+	}
+
+	// the document describing the API, and a page to try it out
+	router.Handler(http.MethodGet, "/api/openapi.json", app.openAPIDocument(api.document(app.baseURL)))
+	router.Handler(http.MethodGet, "/api/docs", dynamic.ThenFunc(app.apiExplorer))
+
+	// moderator middleware chain, for moderators and admins
+	moderator := protected.Append(app.requireRole(models.RoleModerator))
+	router.Handler(http.MethodGet, "/moderation", moderator.ThenFunc(app.moderationQueue))
+	router.Handler(http.MethodPost, "/moderation/reports/:id/dismiss", moderator.ThenFunc(app.moderationDismissPost))
+	router.Handler(http.MethodPost, "/moderation/reports/:id/hide", moderator.ThenFunc(app.moderationHidePost))
+	router.Handler(http.MethodPost, "/moderation/reports/:id/delete", moderator.ThenFunc(app.moderationDeletePost))
+
+	// admin middleware chain, only for users with the admin role
+	admin := protected.Append(app.requireRole(models.RoleAdmin))
+	router.Handler(http.MethodGet, "/admin", admin.ThenFunc(app.adminDashboard))
+	router.Handler(http.MethodGet, "/admin/users", admin.ThenFunc(app.adminUsers))
+	router.Handler(http.MethodPost, "/admin/users/:id/ban", admin.ThenFunc(app.adminUserBanPost))
+	router.Handler(http.MethodPost, "/admin/users/:id/unban", admin.ThenFunc(app.adminUserUnbanPost))
+	router.Handler(http.MethodPost, "/admin/users/:id/role", admin.ThenFunc(app.adminUserRolePost))
+	router.Handler(http.MethodPost, "/admin/users/:id/reset-password", admin.ThenFunc(app.adminUserResetPasswordPost))
+	router.Handler(http.MethodPost, "/admin/snippets/delete", admin.ThenFunc(app.adminSnippetDeletePost))
+	router.Handler(http.MethodGet, "/admin/invites", admin.ThenFunc(app.adminInvites))
+	router.Handler(http.MethodPost, "/admin/invites", admin.ThenFunc(app.adminInviteCreatePost))
+	router.Handler(http.MethodPost, "/admin/invites/:id/delete", admin.ThenFunc(app.adminInviteDeletePost))
 
 	// wraping the middleware
 	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
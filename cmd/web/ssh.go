@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"al.imran.pastely/internal/models"
+	"al.imran.pastely/internal/validator"
+	"golang.org/x/crypto/ssh"
+)
+
+// a whole SSH connection, from the handshake to the URL of the snippet, has
+// to finish within this time
+const sshTimeout = 5 * time.Minute
+
+// struct to hold the form for adding an SSH key
+type accountSSHKeyForm struct {
+	Name                string `form:"name"`
+	PublicKey           string `form:"public_key"`
+	validator.Validator `form:"-"`
+}
+
+// Handler for listing the SSH keys of the logged in user
+func (app *application) accountSSHKeys(w http.ResponseWriter, r *http.Request) {
+	app.renderAccountSSHKeys(w, r, http.StatusOK, accountSSHKeyForm{})
+}
+
+// renderAccountSSHKeys shows the SSH key page with the form
+func (app *application) renderAccountSSHKeys(w http.ResponseWriter, r *http.Request, status int, form accountSSHKeyForm) {
+	keys, err := app.sshKeys.GetAllForUser(contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.SSHKeys = keys
+	data.Form = form
+	app.render(w, status, "sshkeys.tmpl.html", data)
+}
+
+// Handler for adding an SSH key, the key is given in authorized_keys format
+// like ~/.ssh/id_ed25519.pub has it
+func (app *application) accountSSHKeyCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountSSHKeyForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(form.PublicKey))
+	form.CheckField(validator.NotBlank(form.PublicKey), "public_key", "This field cannot be blank")
+	form.CheckField(err == nil, "public_key", "This field must be a public key, e.g. the content of ~/.ssh/id_ed25519.pub")
+
+	// the comment of the key is usually a good enough name
+	if strings.TrimSpace(form.Name) == "" {
+		form.Name = comment
+	}
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxCharCount(form.Name, 100), "name", "This field cannot contain more than 100 characters")
+
+	if !form.Valid() {
+		app.renderAccountSSHKeys(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	err = app.sshKeys.Insert(contextGetUser(r).ID, form.Name, ssh.FingerprintSHA256(key), publicKey)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateSSHKey) {
+			form.AddFiledError("public_key", "This key has already been added")
+			app.renderAccountSSHKeys(w, r, http.StatusUnprocessableEntity, form)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The key has been added.")
+	http.Redirect(w, r, "/account/ssh-keys", http.StatusSeeOther)
+}
+
+// Handler for removing an SSH key
+func (app *application) accountSSHKeyDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form accountSessionForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.sshKeys.Delete(form.ID, contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The key has been removed.")
+	http.Redirect(w, r, "/account/ssh-keys", http.StatusSeeOther)
+}
+
+// loadSSHHostKey reads the private host key of the SSH server from path. a
+// new ed25519 key is generated and saved there if there is none yet.
+func loadSSHHostKey(path string) (ssh.Signer, bool, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		signer, err := ssh.ParsePrivateKey(data)
+		return signer, false, err
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, false, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, false, err
+	}
+	block, err := ssh.MarshalPrivateKey(key, "pastely host key")
+	if err != nil {
+		return nil, false, err
+	}
+	err = os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		return nil, false, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	return signer, true, err
+}
+
+// sshServerConfig returns the configuration of the SSH server. users log in
+// with a key they added on their account page. if anonymous is set, anyone
+// else gets in as well, once their client gave up on its keys.
+func (app *application) sshServerConfig(hostKey ssh.Signer, anonymous bool) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-pastely",
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			keyID, userID, err := app.sshKeys.Authenticate(ssh.FingerprintSHA256(key))
+			if err != nil {
+				if !errors.Is(err, models.ErrNoRecord) {
+					app.errorLogger.Print(err)
+				}
+				return nil, errors.New("unknown public key")
+			}
+
+			user, err := app.user.Get(userID)
+			if err != nil || user.Disabled {
+				return nil, errors.New("account disabled")
+			}
+			return &ssh.Permissions{Extensions: map[string]string{
+				"key-id":  strconv.Itoa(keyID),
+				"user-id": strconv.Itoa(userID),
+			}}, nil
+		},
+	}
+
+	// clients try keyboard-interactive after their keys, so users whose key
+	// is known don't end up anonymous by accident
+	if anonymous {
+		config.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			return &ssh.Permissions{}, nil
+		}
+	}
+
+	config.AddHostKey(hostKey)
+	return config
+}
+
+// sshServer takes pastes over SSH. every session stores what it reads as a
+// snippet and writes back its URL:
+//
+//	ssh pastely.internal < file.log
+//	ssh pastely.internal "build log" < file.log
+//
+// it caps what clients can open, so a few of them can't tie up the server.
+type sshServer struct {
+	app    *application
+	config *ssh.ServerConfig
+	// open connections allowed in all and per IP address, 0 for no limit
+	MaxConns      int
+	MaxConnsPerIP int
+	// sessions a connection may have open at once
+	MaxSessions int
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+	conns    map[net.Conn]struct{}
+	perIP    map[string]int
+	wg       sync.WaitGroup
+}
+
+// Serve accepts connections on l until Shutdown is called, and then returns
+// net.ErrClosed
+func (s *sshServer) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.conns = make(map[net.Conn]struct{})
+	s.perIP = make(map[string]int)
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		// there is no way to tell the client why before the handshake, so
+		// connections over the limits are just closed
+		ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil || !s.track(conn, ip) {
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn, ip)
+			s.app.handleSSHConn(conn, s.config, s.MaxSessions)
+		}()
+	}
+}
+
+// track records a new connection from ip, unless there are as many
+// connections as there may be or the server is shutting down. it is counted
+// in wg under the lock, so Shutdown can't start waiting before it is.
+func (s *sshServer) track(conn net.Conn, ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if s.MaxConns > 0 && len(s.conns) >= s.MaxConns {
+		return false
+	}
+	if s.MaxConnsPerIP > 0 && s.perIP[ip] >= s.MaxConnsPerIP {
+		return false
+	}
+	s.wg.Add(1)
+	s.perIP[ip]++
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack forgets a connection that was closed
+func (s *sshServer) untrack(conn net.Conn, ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.perIP[ip]--
+	if s.perIP[ip] == 0 {
+		delete(s.perIP, ip)
+	}
+	delete(s.conns, conn)
+}
+
+// Shutdown stops accepting connections and waits for the open ones to finish.
+// when ctx is done before that, they are closed and its error is returned.
+func (s *sshServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// handleSSHConn runs the handshake of a connection and serves up to
+// maxSessions sessions of it at once
+func (app *application) handleSSHConn(conn net.Conn, config *ssh.ServerConfig, maxSessions int) {
+	conn.SetDeadline(time.Now().Add(sshTimeout))
+
+	// failed handshakes are mostly scanners and unknown keys, so they are
+	// not logged
+	sconn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(requests)
+
+	// only now the client proved that it has the key
+	if id, ok := sconn.Permissions.Extensions["key-id"]; ok {
+		keyID, _ := strconv.Atoi(id)
+		err = app.sshKeys.Touch(keyID)
+		if err != nil {
+			app.errorLogger.Print(err)
+		}
+	}
+
+	sessions := make(chan struct{}, maxSessions)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+
+		select {
+		case sessions <- struct{}{}:
+		default:
+			newChannel.Reject(ssh.ResourceShortage, "too many open sessions")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { <-sessions }()
+			app.handleSSHSession(sconn.Permissions, channel, channelRequests)
+		}()
+	}
+}
+
+// handleSSHSession waits for the shell or command of a session and pastes
+// its input. a command is used as the title of the snippet.
+func (app *application) handleSSHSession(perms *ssh.Permissions, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		switch req.Type {
+		case "shell", "exec":
+			var command struct{ Command string }
+			if req.Type == "exec" {
+				ssh.Unmarshal(req.Payload, &command)
+			}
+			req.Reply(true, nil)
+
+			status := app.sshPaste(perms, channel, command.Command)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		default:
+			// there are no terminals, so typing a paste ends with ctrl-d
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// sshPaste reads a snippet from channel and writes back its URL. errors and
+// warnings go to stderr. it returns the exit status of the session.
+func (app *application) sshPaste(perms *ssh.Permissions, channel ssh.Channel, title string) uint32 {
+	fail := func(message string) uint32 {
+		fmt.Fprintln(channel.Stderr(), message)
+		return 1
+	}
+
+	var userID int
+	if id, ok := perms.Extensions["user-id"]; ok {
+		userID, _ = strconv.Atoi(id)
+
+		user, err := app.user.Get(userID)
+		if err != nil {
+			app.errorLogger.Print(err)
+			return fail("The server encountered a problem, please try again later")
+		}
+		if user.Disabled {
+			return fail("Your account has been disabled")
+		}
+		if !user.VerifiedAt.Valid {
+			return fail("Please verify your email address before pasting")
+		}
+	}
+
+	content, err := io.ReadAll(io.LimitReader(channel, app.maxPasteSize+1))
+	if err != nil {
+		return fail("The paste could not be read")
+	}
+	if int64(len(content)) > app.maxPasteSize {
+		return fail(fmt.Sprintf("Pastes cannot be larger than %d bytes", app.maxPasteSize))
+	}
+
+	id, warning, errs, err := app.createPaste(title, string(content), userID)
+	if err != nil {
+		app.errorLogger.Print(err)
+		return fail("The server encountered a problem, please try again later")
+	}
+	if errs != "" {
+		return fail(errs)
+	}
+	if warning != "" {
+		fmt.Fprintln(channel.Stderr(), warning)
+	}
+
+	fmt.Fprintf(channel, "%s/snippet/view/%d\n", app.baseURL, id)
+	return 0
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// tcpPasteServer takes pastes over plain TCP, the way termbin does:
+//
+//	cat file.log | nc pastely.internal 9999
+//
+// everything read until the client stops sending is stored as an anonymous
+// snippet and the URL is written back, so it is only started with
+// -anonymous-pastes. netcat doesn't always close its side
+// of the connection, so a paste also ends once the client was quiet for
+// IdleTimeout.
+type tcpPasteServer struct {
+	app *application
+	// the largest paste in bytes
+	MaxSize int64
+	// how long the client may be quiet before the paste is complete, and
+	// how long it may take to send the whole paste
+	IdleTimeout time.Duration
+	ReadTimeout time.Duration
+	// open connections allowed per IP address, 0 for no limit
+	MaxConnsPerIP int
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+	conns    map[net.Conn]struct{}
+	perIP    map[string]int
+	wg       sync.WaitGroup
+}
+
+// Serve accepts connections on l until Shutdown is called, and then returns
+// net.ErrClosed
+func (s *tcpPasteServer) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.conns = make(map[net.Conn]struct{})
+	s.perIP = make(map[string]int)
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		if !s.track(conn, ip) {
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			fmt.Fprintln(conn, "Too many connections from your address, please try again later")
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn, ip)
+			s.handle(conn)
+		}()
+	}
+}
+
+// track records a new connection from ip, unless ip already has as many
+// connections as it may have or the server is shutting down. it is counted
+// in wg under the lock, so Shutdown can't start waiting before it is.
+func (s *tcpPasteServer) track(conn net.Conn, ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if s.MaxConnsPerIP > 0 && s.perIP[ip] >= s.MaxConnsPerIP {
+		return false
+	}
+	s.wg.Add(1)
+	s.perIP[ip]++
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack forgets a connection that was closed
+func (s *tcpPasteServer) untrack(conn net.Conn, ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.perIP[ip]--
+	if s.perIP[ip] == 0 {
+		delete(s.perIP, ip)
+	}
+	delete(s.conns, conn)
+}
+
+// handle reads a paste from conn and writes back its URL or what is wrong
+// with it. there is only one stream, so a warning comes before the URL, and
+// the URL stays the last line.
+func (s *tcpPasteServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	content, err := s.read(conn)
+	if err == nil {
+		var id int
+		var warning, errs string
+		id, warning, errs, err = s.app.createPaste("", string(content), 0)
+		switch {
+		case err != nil:
+			s.app.errorLogger.Print(err)
+			err = errors.New("The server encountered a problem, please try again later")
+		case errs != "":
+			err = errors.New(errs)
+		default:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if warning != "" {
+				fmt.Fprintln(conn, warning)
+			}
+			fmt.Fprintf(conn, "%s/snippet/view/%d\n", s.app.baseURL, id)
+			return
+		}
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	fmt.Fprintln(conn, err)
+}
+
+// read returns what the client sends until it closes its side of the
+// connection or stops sending for IdleTimeout
+func (s *tcpPasteServer) read(conn net.Conn) ([]byte, error) {
+	deadline := time.Now().Add(s.ReadTimeout)
+	content := []byte{}
+	buf := make([]byte, 32*1024)
+
+	for {
+		idle := time.Now().Add(s.IdleTimeout)
+		if idle.After(deadline) {
+			idle = deadline
+		}
+		conn.SetReadDeadline(idle)
+
+		n, err := conn.Read(buf)
+		content = append(content, buf[:n]...)
+		if int64(len(content)) > s.MaxSize {
+			return nil, fmt.Errorf("Pastes cannot be larger than %d bytes", s.MaxSize)
+		}
+
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			if !time.Now().Before(deadline) {
+				return nil, fmt.Errorf("Pastes have to be sent within %s", s.ReadTimeout)
+			}
+			// the client went quiet, so the paste is complete
+			return content, nil
+		case errors.Is(err, io.EOF):
+			return content, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// Shutdown stops accepting connections and waits for the open ones to finish.
+// when ctx is done before that, they are closed and its error is returned.
+func (s *tcpPasteServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
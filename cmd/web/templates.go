@@ -3,6 +3,7 @@ package main
 import (
 	"html/template"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"al.imran.pastely/internal/models"
@@ -15,6 +16,7 @@ func humanDate(t time.Time) string {
 
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"contains":  slices.Contains[[]string],
 }
 
 // Create a templateData to hold all the dynamic data that we want to render on the page
@@ -22,9 +24,27 @@ type templateData struct {
 	CurrentYear     int
 	Snippet         *models.Snippet
 	Snippets        []*models.Snippet
+	User            *models.User
+	Sessions        []*models.Session
+	CurrentSession  int
 	Form            any
 	Flash           string
 	IsAuthenticated bool
+	UserName        string
+	IsAdmin         bool
+	IsModerator     bool
+	OIDCEnabled     bool
+	APITokens       []*models.APIToken
+	NewAPIToken     string
+	APIScopes       []string
+	SSHKeys         []*models.SSHKey
+	Registration    string
+	Invites         []*models.Invite
+	NewInviteCode   string
+	Challenge       string
+	Reports         []*models.Report
+	Users           []*models.User
+	Stats           map[string]int
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
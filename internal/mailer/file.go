@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every email as an .eml file to Dir instead of sending it.
+// It is meant for development and for testing without a mail server.
+type FileMailer struct {
+	Dir    string
+	Sender string
+}
+
+// Send renders the template and writes it to a new file in Dir
+func (m *FileMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.Sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), filepath.Base(recipient))
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.bytes(), 0o644)
+}
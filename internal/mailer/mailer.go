@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer is implemented by anything that can deliver an email built from one
+// of the embedded templates
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// message holds a rendered email ready to be delivered
+type message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// render executes the "subject" and "body" templates of templateFile with data
+func render(sender, recipient, templateFile string, data any) (*message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	body := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(body, "body", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message{
+		From:    sender,
+		To:      recipient,
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
+
+// bytes returns the message formatted as an RFC 5322 email
+func (msg *message) bytes() []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(buf, "\r\n%s", msg.Body)
+	return buf.Bytes()
+}
@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+)
+
+// SMTPMailer delivers emails through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string
+}
+
+// Send renders the template and delivers it to the recipient
+func (m *SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(m.Sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	// only authenticate when credentials are configured, a local relay
+	// usually doesn't need them
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.Sender, []string{recipient}, msg.bytes())
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// the scopes a personal access token can be granted
+const (
+	ScopeSnippetsRead   = "snippets:read"
+	ScopeSnippetsWrite  = "snippets:write"
+	ScopeSnippetsDelete = "snippets:delete"
+	ScopeAccountWrite   = "account:write"
+)
+
+// AllAPIScopes lists every scope, in the order they are shown to users
+var AllAPIScopes = []string{ScopeSnippetsRead, ScopeSnippetsWrite, ScopeSnippetsDelete, ScopeAccountWrite}
+
+// DefaultAPIScopes are granted when no scopes are asked for. account:write
+// has to be asked for explicitly.
+var DefaultAPIScopes = []string{ScopeSnippetsRead, ScopeSnippetsWrite, ScopeSnippetsDelete}
+
+// every personal access token starts with this prefix, which makes them easy
+// to recognise, e.g. by secret scanners
+const apiTokenPrefix = "pst_"
+
+// a personal access token. the plain-text token is only known when it is
+// created and is never stored.
+type APIToken struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scopes   []string
+	Created  time.Time
+	Expires  sql.NullTime
+	LastUsed sql.NullTime
+}
+
+// HasScope returns true if the token was granted scope
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// Define an API token model that wraps around a database connection pool
+type APITokenModel struct {
+	DB *sql.DB
+}
+
+// Insert will create a new token for a user and return the plain-text token,
+// which has to be shown to the user right away. a zero ttl never expires.
+func (m *APITokenModel) Insert(userID int, name string, scopes []string, ttl time.Duration) (string, error) {
+	plaintext, _, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	plaintext = apiTokenPrefix + plaintext
+
+	seconds := int(ttl.Seconds())
+
+	stm := `INSERT INTO api_tokens (user_id, name, hash, scopes, created, expires)
+	VALUES(?, ?, ?, ?, NOW(), IF(? > 0, DATE_ADD(NOW(), INTERVAL ? SECOND), NULL))`
+
+	_, err = m.DB.Exec(stm, userID, name, hashToken(plaintext), strings.Join(scopes, ","), seconds, seconds)
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// GetAllForUser will return the tokens of a user, newest first
+func (m *APITokenModel) GetAllForUser(userID int) ([]*APIToken, error) {
+	stm := `SELECT id, user_id, name, scopes, created, expires, last_used
+		FROM api_tokens WHERE user_id=? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stm, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*APIToken{}
+
+	for rows.Next() {
+		t := &APIToken{}
+		var scopes string
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.Created, &t.Expires, &t.LastUsed)
+		if err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Authenticate will look up a non-expired token by its plain-text value and
+// record that it was used. ErrInvalidToken is returned if there is none.
+func (m *APITokenModel) Authenticate(plaintext string) (*APIToken, error) {
+	if !strings.HasPrefix(plaintext, apiTokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+	hash := hashToken(plaintext)
+
+	stm := `SELECT id, user_id, name, scopes, created, expires, last_used
+		FROM api_tokens WHERE hash=? AND (expires IS NULL OR expires > NOW())`
+
+	t := &APIToken{}
+	var scopes string
+	err := m.DB.QueryRow(stm, hash).Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.Created, &t.Expires, &t.LastUsed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidToken
+		} else {
+			return nil, err
+		}
+	}
+	t.Scopes = strings.Split(scopes, ",")
+
+	_, err = m.DB.Exec("UPDATE api_tokens SET last_used=NOW() WHERE id=?", t.ID)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Delete will revoke a token of a user
+func (m *APITokenModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec("DELETE FROM api_tokens WHERE id=? AND user_id=?", id, userID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+// DeleteAllForUser will revoke every token of a user
+func (m *APITokenModel) DeleteAllForUser(userID int) error {
+	_, err := m.DB.Exec("DELETE FROM api_tokens WHERE user_id=?", userID)
+	return err
+}
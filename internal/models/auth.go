@@ -0,0 +1,42 @@
+package models
+
+import (
+	"errors"
+)
+
+// Authenticator checks an email and password and returns the id of the local
+// user they belong to. It returns ErrInvalidCredential if they don't match.
+type Authenticator interface {
+	Authenticate(email, password string) (int, error)
+}
+
+// AuthenticatorChain tries each authenticator in turn. the first one that
+// accepts the credentials wins. ErrAccountDisabled and ErrRegistrationClosed
+// stop the chain as the credentials matched, but can't be used. an
+// authenticator that fails in any other way, e.g. a directory that is down,
+// is skipped so it doesn't break logging in with the others. its error is
+// only returned if none of them could check the credentials.
+type AuthenticatorChain []Authenticator
+
+// Authenticate implements Authenticator
+func (c AuthenticatorChain) Authenticate(email, password string) (int, error) {
+	var failed error
+	checked := false
+
+	for _, a := range c {
+		id, err := a.Authenticate(email, password)
+		switch {
+		case err == nil, errors.Is(err, ErrAccountDisabled), errors.Is(err, ErrRegistrationClosed):
+			return id, err
+		case errors.Is(err, ErrInvalidCredential):
+			checked = true
+		case failed == nil:
+			failed = err
+		}
+	}
+
+	if failed != nil && !checked {
+		return 0, failed
+	}
+	return 0, ErrInvalidCredential
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Define a challenge model that remembers used proof-of-work challenges
+type ChallengeModel struct {
+	DB *sql.DB
+}
+
+// Use will mark the challenge with the given id as used until it expires. It
+// returns ErrInvalidToken if the challenge was used before.
+func (m *ChallengeModel) Use(id string, expires time.Time) error {
+	// forget the challenges that can't be used anymore anyway
+	_, err := m.DB.Exec("DELETE FROM pow_solutions WHERE expires < NOW()")
+	if err != nil {
+		return err
+	}
+
+	stm := `INSERT INTO pow_solutions (id, expires)
+	VALUES(?, DATE_ADD(NOW(), INTERVAL ? SECOND))`
+
+	_, err = m.DB.Exec(stm, id, int(time.Until(expires).Seconds())+1)
+	if err != nil {
+		var MySQLError *mysql.MySQLError
+		if errors.As(err, &MySQLError) && MySQLError.Number == 1062 {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	return nil
+}
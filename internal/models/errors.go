@@ -1,6 +1,7 @@
 package models
 
 import (
+	"database/sql"
 	"errors"
 )
 
@@ -10,4 +11,50 @@ var (
 	ErrInvalidCredential = errors.New("models: invalid creadentials!")
 
 	ErrDuplicateEmail = errors.New("models: duplicate emails")
+
+	ErrInvalidToken = errors.New("models: invalid or expired token")
+
+	ErrAccountDisabled = errors.New("models: account disabled")
+
+	ErrInvalidInvite = errors.New("models: invalid or used up invite code")
+
+	ErrDuplicateSSHKey = errors.New("models: duplicate ssh key")
+
+	ErrRegistrationClosed = errors.New("models: registration closed")
 )
+
+// checkRowsAffected returns ErrNoRecord if a statement didn't match any row
+func checkRowsAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// checkRowsMatched returns ErrNoRecord if an update of the row with the given
+// id in table didn't match it. mysql only counts rows that were changed, so
+// setting a value a row already has is told apart from a missing row by
+// looking the row up.
+func checkRowsMatched(db *sql.DB, result sql.Result, table string, id int) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = db.QueryRow("SELECT EXISTS(SELECT true FROM "+table+" WHERE id=?)", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoRecord
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// a gist is a group of snippets, one per file, sorted by file name. secret
+// gists have unlisted snippets, so like them they are only left out of the
+// lists and can still be found by id.
+type Gist struct {
+	ID          int
+	UserID      int // 0 if the owner was deleted
+	Description string
+	Public      bool
+	Created     time.Time
+	Updated     time.Time
+	Files       []*Snippet // the title of a snippet is its file name
+}
+
+// a file of a gist that is created or changed
+type GistFile struct {
+	Name     string
+	Content  string
+	Language string
+	Hidden   bool // hidden pending review
+}
+
+// Define a gist model that wraps around a database connection pool
+type GistModel struct {
+	DB *sql.DB
+}
+
+// Insert will create a gist owned by userID with the given files. the
+// snippets expire after a year, like the longest lived snippets do.
+func (m *GistModel) Insert(userID int, description string, public bool, files []GistFile) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	stm := `INSERT INTO gists (user_id, description, public, created, updated)
+	VALUES(NULLIF(?, 0), ?, ?, NOW(), NOW())`
+
+	result, err := tx.Exec(stm, userID, description, public)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, f := range files {
+		err = insertGistFile(tx, int(id), userID, public, f)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(id), tx.Commit()
+}
+
+// insertGistFile adds the snippet of a file to a gist
+func insertGistFile(db execer, gistID, userID int, public bool, f GistFile) error {
+	visibility := VisibilityPublic
+	if !public {
+		visibility = VisibilityUnlisted
+	}
+
+	stm := `INSERT INTO snippets (title, content, created, expires, user_id, language, visibility, gist_id, hidden)
+	VALUES(?, ?, NOW(), DATE_ADD(NOW(), INTERVAL 365 DAY), NULLIF(?, 0), ?, ?, ?, ?)`
+
+	_, err := db.Exec(stm, f.Name, f.Content, userID, f.Language, visibility, gistID, f.Hidden)
+	return err
+}
+
+// Get will return the gist with the given id and its files that haven't
+// expired
+func (m *GistModel) Get(id int) (*Gist, error) {
+	stm := `SELECT id, COALESCE(user_id, 0), description, public, created, updated
+		FROM gists WHERE id=?`
+
+	g := &Gist{}
+	err := m.DB.QueryRow(stm, id).Scan(&g.ID, &g.UserID, &g.Description, &g.Public, &g.Created, &g.Updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	g.Files, err = m.files(g.ID)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ForUser will return up to limit gists of a user, newest first, skipping
+// the first offset. secret gists are left out unless secret is true.
+func (m *GistModel) ForUser(userID int, secret bool, limit, offset int) ([]*Gist, error) {
+	stm := `SELECT id, COALESCE(user_id, 0), description, public, created, updated
+		FROM gists WHERE user_id=? AND (? OR public)
+		ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stm, userID, secret, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gists := []*Gist{}
+
+	for rows.Next() {
+		g := &Gist{}
+		err = rows.Scan(&g.ID, &g.UserID, &g.Description, &g.Public, &g.Created, &g.Updated)
+		if err != nil {
+			return nil, err
+		}
+		gists = append(gists, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, g := range gists {
+		g.Files, err = m.files(g.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return gists, nil
+}
+
+// files will return the snippets of a gist that haven't expired
+func (m *GistModel) files(gistID int) ([]*Snippet, error) {
+	stm := `SELECT id, title, content, created, expires, COALESCE(user_id, 0), hidden, language, visibility
+		FROM snippets WHERE gist_id=? AND expires > NOW() ORDER BY title`
+
+	rows, err := m.DB.Query(stm, gistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hidden, &s.Language, &s.Visibility)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+// Update will change the description of a gist and replace its files with
+// the given ones. files that keep their name keep their snippet, which
+// expires a year from now again. names are compared case-insensitively, like
+// mysql does, so a file whose name only changes in case keeps its snippet
+// too. a file that is hidden stays hidden.
+func (m *GistModel) Update(id int, description string, files []GistFile) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// lock the gist so concurrent updates wait for each other
+	var userID int
+	var public bool
+	stm := `SELECT COALESCE(user_id, 0), public FROM gists WHERE id=? FOR UPDATE`
+	err = tx.QueryRow(stm, id).Scan(&userID, &public)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		} else {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE gists SET description=?, updated=NOW() WHERE id=?", description, id)
+	if err != nil {
+		return err
+	}
+
+	// the snippets of the files the gist has now, expired or not, by their
+	// lowercased names
+	existing := make(map[string]int)
+	rows, err := tx.Query("SELECT id, title FROM snippets WHERE gist_id=?", id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var snippetID int
+		var name string
+		err = rows.Scan(&snippetID, &name)
+		if err != nil {
+			return err
+		}
+		existing[strings.ToLower(name)] = snippetID
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, f := range files {
+		snippetID, ok := existing[strings.ToLower(f.Name)]
+		if !ok {
+			err = insertGistFile(tx, id, userID, public, f)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		delete(existing, strings.ToLower(f.Name))
+
+		stm := `UPDATE snippets SET title=?, content=?, language=?, hidden=hidden OR ?,
+			expires=DATE_ADD(NOW(), INTERVAL 365 DAY) WHERE id=?`
+		_, err = tx.Exec(stm, f.Name, f.Content, f.Language, f.Hidden, snippetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// whatever is left was removed
+	for _, snippetID := range existing {
+		_, err = tx.Exec("DELETE FROM snippets WHERE id=?", snippetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete will remove a gist and its snippets
+func (m *GistModel) Delete(id int) error {
+	result, err := m.DB.Exec("DELETE FROM gists WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Define an identity model that wraps around a database connection pool. It
+// links identities at external providers to local users.
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// GetUserID will return the id of the user linked to the external identity
+func (m *IdentityModel) GetUserID(issuer, subject string) (int, error) {
+	var userID int
+
+	stm := "SELECT user_id FROM user_identities WHERE issuer=? AND subject=?"
+
+	err := m.DB.QueryRow(stm, issuer, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+// Insert will link the external identity to a user
+func (m *IdentityModel) Insert(userID int, issuer, subject string) error {
+	stm := `INSERT INTO user_identities (user_id, issuer, subject, created)
+	VALUES(?, ?, ?, NOW())`
+
+	_, err := m.DB.Exec(stm, userID, issuer, subject)
+	return err
+}
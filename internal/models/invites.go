@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// an invite code. the plain-text code is only known when it is created.
+type Invite struct {
+	ID        int
+	Note      string
+	CreatedBy string // the inviter's name, empty if they were deleted
+	MaxUses   int
+	Uses      int
+	Created   time.Time
+	Expires   sql.NullTime
+}
+
+// Define an invite model that wraps around a database connection pool
+type InviteModel struct {
+	DB *sql.DB
+}
+
+// Insert will create an invite code that can be used maxUses times and
+// return the plain-text code. a zero ttl never expires.
+func (m *InviteModel) Insert(createdBy int, note string, maxUses int, ttl time.Duration) (string, error) {
+	plaintext, hash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	seconds := int(ttl.Seconds())
+
+	stm := `INSERT INTO invites (hash, note, created_by, max_uses, created, expires)
+	VALUES(?, ?, ?, ?, NOW(), IF(? > 0, DATE_ADD(NOW(), INTERVAL ? SECOND), NULL))`
+
+	_, err = m.DB.Exec(stm, hash, note, createdBy, maxUses, seconds, seconds)
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// All will return every invite, newest first
+func (m *InviteModel) All() ([]*Invite, error) {
+	stm := `SELECT i.id, i.note, COALESCE(u.name, ''), i.max_uses, i.uses, i.created, i.expires
+		FROM invites i LEFT JOIN users u ON u.id = i.created_by
+		ORDER BY i.id DESC`
+
+	rows, err := m.DB.Query(stm)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*Invite{}
+
+	for rows.Next() {
+		i := &Invite{}
+		err = rows.Scan(&i.ID, &i.Note, &i.CreatedBy, &i.MaxUses, &i.Uses, &i.Created, &i.Expires)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// Delete will revoke an invite. users who already signed up with it stay.
+func (m *InviteModel) Delete(id int) error {
+	result, err := m.DB.Exec("DELETE FROM invites WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
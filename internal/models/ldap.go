@@ -0,0 +1,116 @@
+package models
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPAuthenticator authenticates users against an LDAP directory by binding
+// with their own credentials. The user's entry is found by searching BaseDN
+// with UserFilter, using the service account BindDN if one is set. On the
+// first successful login a shadow row is created in the users table, so the
+// rest of the application can treat directory users like local ones. ldap://
+// URLs are upgraded with StartTLS, so the server needs a valid certificate.
+// CanProvision decides whether the shadow row may be created for an email
+// address, ErrRegistrationClosed is returned if it may not. nil allows
+// everyone.
+type LDAPAuthenticator struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	UserFilter   string // e.g. (mail=%s), %s is replaced by the escaped email
+	NameAttr     string
+	EmailAttr    string
+	Users        *UserModel
+	CanProvision func(email string) bool
+}
+
+// Authenticate implements Authenticator
+func (a *LDAPAuthenticator) Authenticate(email, password string) (int, error) {
+	// an empty password would be an unauthenticated bind, which most servers
+	// accept without checking anything
+	if password == "" {
+		return 0, ErrInvalidCredential
+	}
+
+	conn, err := ldap.DialURL(a.URL)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	// the password is sent with the bind, so plain ldap:// connections are
+	// upgraded before that. ldaps:// is encrypted from the start.
+	if strings.HasPrefix(strings.ToLower(a.URL), "ldap://") {
+		u, err := url.Parse(a.URL)
+		if err != nil {
+			return 0, err
+		}
+		err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()})
+		if err != nil {
+			return 0, fmt.Errorf("models: ldap starttls: %w", err)
+		}
+	}
+
+	if a.BindDN != "" {
+		err = conn.Bind(a.BindDN, a.BindPassword)
+		if err != nil {
+			return 0, fmt.Errorf("models: ldap service bind: %w", err)
+		}
+	}
+
+	search := ldap.NewSearchRequest(
+		a.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf(a.UserFilter, ldap.EscapeFilter(email)),
+		[]string{"dn", a.NameAttr, a.EmailAttr},
+		nil,
+	)
+	// no entry, or more than one, means we can't tell who this is. the size
+	// limit of 2 makes the server refuse a search that matches more than one.
+	result, err := conn.Search(search)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return 0, ErrInvalidCredential
+		}
+		return 0, err
+	}
+	if len(result.Entries) != 1 {
+		return 0, ErrInvalidCredential
+	}
+	entry := result.Entries[0]
+
+	err = conn.Bind(entry.DN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return 0, ErrInvalidCredential
+		}
+		return 0, err
+	}
+
+	name := entry.GetAttributeValue(a.NameAttr)
+	mail := entry.GetAttributeValue(a.EmailAttr)
+	if mail == "" {
+		mail = email
+	}
+
+	user, err := a.Users.GetByEmail(mail)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			if a.CanProvision != nil && !a.CanProvision(mail) {
+				return 0, ErrRegistrationClosed
+			}
+			return a.Users.Provision(name, mail)
+		}
+		return 0, err
+	}
+	if user.Disabled {
+		return 0, ErrAccountDisabled
+	}
+	return user.ID, nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Define a login attempt model that remembers failed logins
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// Insert will record a failed login for email from ip
+func (m *LoginAttemptModel) Insert(email, ip string) error {
+	// forget the attempts that are too old to matter anyway
+	_, err := m.DB.Exec("DELETE FROM login_attempts WHERE created < DATE_SUB(NOW(), INTERVAL 1 DAY)")
+	if err != nil {
+		return err
+	}
+
+	stm := `INSERT INTO login_attempts (email, ip, created) VALUES(?, ?, NOW())`
+
+	_, err = m.DB.Exec(stm, strings.ToLower(email), ip)
+	return err
+}
+
+// CountRecent will return how many logins failed since the given time for
+// email, and from ip
+func (m *LoginAttemptModel) CountRecent(email, ip string, since time.Time) (int, int, error) {
+	var byEmail, byIP int
+
+	stm := `SELECT
+		(SELECT COUNT(*) FROM login_attempts WHERE email=? AND created > ?),
+		(SELECT COUNT(*) FROM login_attempts WHERE ip=? AND created > ?)`
+
+	err := m.DB.QueryRow(stm, strings.ToLower(email), since, ip, since).Scan(&byEmail, &byIP)
+	return byEmail, byIP, err
+}
+
+// DeleteForEmail will forget the failed logins for email, once its owner
+// logged in
+func (m *LoginAttemptModel) DeleteForEmail(email string) error {
+	_, err := m.DB.Exec("DELETE FROM login_attempts WHERE email=?", strings.ToLower(email))
+	return err
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// the password hashing algorithms we support
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var errUnknownHashFormat = errors.New("models: unknown password hash format")
+
+// PasswordHasher hashes new passwords with the configured algorithm and
+// parameters. Stored hashes are self-describing: argon2id hashes use the PHC
+// string format ($argon2id$v=19$m=...,t=...,p=...$salt$hash) and bcrypt
+// hashes use their usual $2a$/$2b$ format, so both can be verified no matter
+// what is configured.
+type PasswordHasher struct {
+	Algorithm string
+
+	BcryptCost int
+
+	Argon2Memory  uint32 // in KiB
+	Argon2Time    uint32
+	Argon2Threads uint8
+	Argon2KeyLen  uint32
+	Argon2SaltLen uint32
+}
+
+// DefaultPasswordHasher is used when a UserModel has no hasher configured. It
+// matches the bcrypt cost of 12 that was used before hashes were versioned.
+var DefaultPasswordHasher = &PasswordHasher{
+	Algorithm:     AlgorithmBcrypt,
+	BcryptCost:    12,
+	Argon2Memory:  64 * 1024,
+	Argon2Time:    3,
+	Argon2Threads: 2,
+	Argon2KeyLen:  32,
+	Argon2SaltLen: 16,
+}
+
+// Hash returns the encoded hash of password
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case AlgorithmArgon2id:
+		salt := make([]byte, h.Argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey([]byte(password), salt, h.Argon2Time, h.Argon2Memory, h.Argon2Threads, h.Argon2KeyLen)
+
+		b64 := base64.RawStdEncoding
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, h.Argon2Memory, h.Argon2Time, h.Argon2Threads,
+			b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+
+	case AlgorithmBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(hash), err
+
+	default:
+		return "", fmt.Errorf("models: unknown password algorithm %q", h.Algorithm)
+	}
+}
+
+// Verify returns true if password matches the encoded hash. needsRehash is
+// true when the hash was made with a different algorithm or weaker parameters
+// than the ones configured, so the caller should store a fresh hash.
+func (h *PasswordHasher) Verify(password, encoded string) (match bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		var version int
+		var memory, time uint32
+		var threads uint8
+
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 6 {
+			return false, false, errUnknownHashFormat
+		}
+		_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+		if err != nil {
+			return false, false, err
+		}
+		_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads)
+		if err != nil {
+			return false, false, err
+		}
+
+		b64 := base64.RawStdEncoding
+		salt, err := b64.DecodeString(parts[4])
+		if err != nil {
+			return false, false, err
+		}
+		key, err := b64.DecodeString(parts[5])
+		if err != nil {
+			return false, false, err
+		}
+
+		otherKey := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+			return false, false, nil
+		}
+
+		needsRehash = h.Algorithm != AlgorithmArgon2id || version != argon2.Version ||
+			memory < h.Argon2Memory || time < h.Argon2Time || threads < h.Argon2Threads ||
+			uint32(len(key)) < h.Argon2KeyLen
+		return true, needsRehash, nil
+
+	case strings.HasPrefix(encoded, "$2"):
+		err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, false, err
+		}
+
+		needsRehash = h.Algorithm != AlgorithmBcrypt || cost < h.BcryptCost
+		return true, needsRehash, nil
+
+	default:
+		return false, false, errUnknownHashFormat
+	}
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// a report of an abusive snippet, together with some details of the snippet
+type Report struct {
+	ID            int
+	SnippetID     int
+	SnippetTitle  string
+	SnippetHidden bool
+	Reason        string
+	ReporterIP    string
+	Created       time.Time
+	Status        string
+}
+
+// Define a report model that wraps around a database connection pool
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// Insert will record a new report on a snippet. reporterID is 0 for
+// anonymous reporters.
+func (m *ReportModel) Insert(snippetID int, reason, reporterIP string, reporterID int) error {
+	stm := `INSERT INTO reports (snippet_id, reason, reporter_ip, reporter_id, created)
+	VALUES(?, ?, ?, NULLIF(?, 0), NOW())`
+
+	_, err := m.DB.Exec(stm, snippetID, reason, reporterIP, reporterID)
+	return err
+}
+
+// CountRecentByIP will return how many reports were made from ip since the given time
+func (m *ReportModel) CountRecentByIP(ip string, since time.Time) (int, error) {
+	var count int
+
+	stm := "SELECT COUNT(*) FROM reports WHERE reporter_ip=? AND created > ?"
+
+	err := m.DB.QueryRow(stm, ip, since).Scan(&count)
+	return count, err
+}
+
+// Open will return the reports that haven't been dealt with yet, oldest first
+func (m *ReportModel) Open() ([]*Report, error) {
+	stm := `SELECT r.id, r.snippet_id, s.title, s.hidden, r.reason, r.reporter_ip, r.created
+		FROM reports r JOIN snippets s ON s.id = r.snippet_id
+		WHERE r.status = 'open' ORDER BY r.id`
+
+	rows, err := m.DB.Query(stm)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+
+	for rows.Next() {
+		r := &Report{}
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.SnippetTitle, &r.SnippetHidden, &r.Reason, &r.ReporterIP, &r.Created)
+		r.Status = "open"
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// Get will return a single report
+func (m *ReportModel) Get(id int) (*Report, error) {
+	stm := `SELECT r.id, r.snippet_id, s.title, s.hidden, r.reason, r.reporter_ip, r.created, r.status
+		FROM reports r JOIN snippets s ON s.id = r.snippet_id
+		WHERE r.id=?`
+
+	r := &Report{}
+	err := m.DB.QueryRow(stm, id).Scan(&r.ID, &r.SnippetID, &r.SnippetTitle, &r.SnippetHidden, &r.Reason, &r.ReporterIP, &r.Created, &r.Status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Dismiss will close a report without acting on the snippet. dismissing a
+// report twice is not an error.
+func (m *ReportModel) Dismiss(id int) error {
+	result, err := m.DB.Exec("UPDATE reports SET status='dismissed' WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	return checkRowsMatched(m.DB, result, "reports", id)
+}
+
+// CountOpenForSnippet will return how many open reports a snippet has
+func (m *ReportModel) CountOpenForSnippet(snippetID int) (int, error) {
+	var count int
+
+	stm := "SELECT COUNT(*) FROM reports WHERE snippet_id=? AND status='open'"
+
+	err := m.DB.QueryRow(stm, snippetID).Scan(&count)
+	return count, err
+}
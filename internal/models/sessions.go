@@ -0,0 +1,102 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// a session the user logged in with, together with the device it came from
+type Session struct {
+	ID        int
+	Token     string
+	UserAgent string
+	IP        string
+	Created   time.Time
+	Expiry    time.Time
+}
+
+// Define a session model that wraps around a database connection pool. The
+// session data itself is kept by scs in the sessions table, this model only
+// keeps track of which of those sessions belong to which user.
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// Insert will record that the session token belongs to the user
+func (m *SessionModel) Insert(token string, userID int, userAgent, ip string) error {
+	// the user agent is only informative, so we truncate rather than fail
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	stm := `INSERT INTO user_sessions (token, user_id, user_agent, ip, created)
+	VALUES(?, ?, ?, ?, NOW())`
+
+	_, err := m.DB.Exec(stm, token, userID, userAgent, ip)
+	return err
+}
+
+// GetAllForUser will return the sessions of a user which haven't expired yet,
+// most recent login first
+func (m *SessionModel) GetAllForUser(userID int) ([]*Session, error) {
+	// scs stores the expiry in UTC
+	stm := `SELECT us.id, us.token, us.user_agent, us.ip, us.created, s.expiry
+		FROM user_sessions us JOIN sessions s ON s.token = us.token
+		WHERE us.user_id=? AND s.expiry > UTC_TIMESTAMP(6)
+		ORDER BY us.created DESC`
+
+	rows, err := m.DB.Query(stm, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		s := &Session{}
+		err = rows.Scan(&s.ID, &s.Token, &s.UserAgent, &s.IP, &s.Created, &s.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Get will return a single session of a user, without its expiry
+func (m *SessionModel) Get(id, userID int) (*Session, error) {
+	stm := `SELECT id, token, user_agent, ip, created
+		FROM user_sessions WHERE id=? AND user_id=?`
+
+	s := &Session{}
+	err := m.DB.QueryRow(stm, id, userID).Scan(&s.ID, &s.Token, &s.UserAgent, &s.IP, &s.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Delete will forget the session with the given token
+func (m *SessionModel) Delete(token string) error {
+	_, err := m.DB.Exec("DELETE FROM user_sessions WHERE token=?", token)
+	return err
+}
+
+// DeleteStale will remove records whose scs session has expired or was removed
+func (m *SessionModel) DeleteStale() error {
+	stm := `DELETE us FROM user_sessions us LEFT JOIN sessions s ON s.token = us.token
+		WHERE s.token IS NULL OR s.expiry <= UTC_TIMESTAMP(6)`
+
+	_, err := m.DB.Exec(stm)
+	return err
+}
@@ -6,13 +6,32 @@ import (
 	"time"
 )
 
+// who can see a snippet. snippet ids are sequential, so unlisted snippets
+// are only kept out of the lists and anyone can still find them by id. only
+// private snippets are kept from others.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted" // not listed, but not secret either
+	VisibilityPrivate  = "private"  // only the owner
+)
+
 // defining a Snippet type to hold individual snippet
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID         int
+	Title      string
+	Content    string
+	Created    time.Time
+	Expires    time.Time
+	UserID     int // 0 for anonymous snippets
+	Hidden     bool
+	Language   string // "" if unknown
+	Visibility string
+}
+
+// CanView returns true if the user with the given id, 0 for anonymous
+// users, may see the snippet
+func (s *Snippet) CanView(userID int) bool {
+	return s.Visibility != VisibilityPrivate || (userID != 0 && s.UserID == userID)
 }
 
 // Defining a snippetModel type that wraps around sql.DB connection pool
@@ -20,14 +39,15 @@ type SnippetModel struct {
 	DB *sql.DB
 }
 
-// this will insert a new snippet into the database
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// this will insert a new snippet into the database, owned by userID or
+// anonymous if userID is 0. language may be empty.
+func (m *SnippetModel) Insert(title string, content string, expires int, userID int, language, visibility string) (int, error) {
 	// sql query for inserting a snippets into the database
-	stm := `INSERT INTO snippets(title, content, created, expires)
-	VALUES(?, ?, NOW(), DATE_ADD(NOW(), INTERVAL ? DAY))`
+	stm := `INSERT INTO snippets(title, content, created, expires, user_id, language, visibility)
+	VALUES(?, ?, NOW(), DATE_ADD(NOW(), INTERVAL ? DAY), NULLIF(?, 0), ?, ?)`
 
 	// execute the sql query
-	result, err := m.DB.Exec(stm, title, content, expires)
+	result, err := m.DB.Exec(stm, title, content, expires, userID, language, visibility)
 	if err != nil {
 		return 0, err
 	}
@@ -44,7 +64,7 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 // this will return a specific snippet with specific id
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	// query for a specific snippet
-	stm := `SELECT id, title, content, created, expires
+	stm := `SELECT id, title, content, created, expires, COALESCE(user_id, 0), hidden, language, visibility
 		FROM snippets WHERE expires > NOW() AND id=?`
 
 	// returns a sql.ROW object
@@ -54,7 +74,7 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	s := &Snippet{}
 
 	// copy the fields data from sql.Row to s Snippet struct
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hidden, &s.Language, &s.Visibility)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -66,11 +86,29 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	return s, nil
 }
 
+// GetAny will return a snippet with a specific id even if it has expired
+func (m *SnippetModel) GetAny(id int) (*Snippet, error) {
+	stm := `SELECT id, title, content, created, expires, COALESCE(user_id, 0), hidden, language, visibility
+		FROM snippets WHERE id=?`
+
+	s := &Snippet{}
+	err := m.DB.QueryRow(stm, id).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hidden, &s.Language, &s.Visibility)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
 // This will return 10 recently created snippets
 func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	// sql query
-	stm := `SELECT id, title, content, created, expires
-		FROM snippets WHERE expires > NOW() ORDER BY id DESC
+	stm := `SELECT id, title, content, created, expires, COALESCE(user_id, 0), hidden, language, visibility
+		FROM snippets WHERE expires > NOW() AND NOT hidden AND visibility = 'public'
+		ORDER BY id DESC
 		LIMIT 10`
 
 	// Execute the query
@@ -89,7 +127,7 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 		s := &Snippet{}
 
 		// Now use rows.Scan() to convert sql rows to snippet struct
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hidden, &s.Language, &s.Visibility)
 		if err != nil {
 			return nil, err
 		}
@@ -107,3 +145,79 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	return snippets, nil
 
 }
+
+// List will return up to limit snippets, newest first, skipping the first
+// offset. hidden snippets are left out. with a userID it only returns the
+// snippets of that user, including unlisted and private ones, otherwise only
+// public snippets.
+func (m *SnippetModel) List(userID, limit, offset int) ([]*Snippet, error) {
+	stm := `SELECT id, title, content, created, expires, COALESCE(user_id, 0), hidden, language, visibility
+		FROM snippets WHERE expires > NOW() AND NOT hidden AND (? = 0 OR user_id = ?)
+		AND (? > 0 OR visibility = 'public')
+		ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stm, userID, userID, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.UserID, &s.Hidden, &s.Language, &s.Visibility)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+// Update will change the title, content and language of a snippet. if expires
+// isn't 0 the snippet will expire that many days from now, otherwise its
+// expiry is kept.
+func (m *SnippetModel) Update(id int, title, content, language string, expires int) error {
+	stm := `UPDATE snippets SET title=?, content=?, language=?,
+		expires=IF(? > 0, DATE_ADD(NOW(), INTERVAL ? DAY), expires)
+		WHERE id=?`
+
+	_, err := m.DB.Exec(stm, title, content, language, expires, expires, id)
+	return err
+}
+
+// Delete will remove the snippet with the given id
+func (m *SnippetModel) Delete(id int) error {
+	result, err := m.DB.Exec("DELETE FROM snippets WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+// Count will return the number of snippets that are still active and the
+// number of expired snippets that are still stored
+func (m *SnippetModel) Count() (int, int, error) {
+	var active, expired int
+
+	stm := `SELECT COALESCE(SUM(expires > NOW()), 0), COALESCE(SUM(expires <= NOW()), 0)
+		FROM snippets`
+
+	err := m.DB.QueryRow(stm).Scan(&active, &expired)
+	return active, expired, err
+}
+
+// SetHidden will hide a snippet from everyone but moderators, or show it
+// again. hiding a hidden snippet is not an error.
+func (m *SnippetModel) SetHidden(id int, hidden bool) error {
+	result, err := m.DB.Exec("UPDATE snippets SET hidden=? WHERE id=?", hidden, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsMatched(m.DB, result, "snippets", id)
+}
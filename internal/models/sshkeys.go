@@ -0,0 +1,104 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// a public key a user pastes with over SSH
+type SSHKey struct {
+	ID          int
+	UserID      int
+	Name        string
+	Fingerprint string
+	PublicKey   string
+	Created     time.Time
+	LastUsed    sql.NullTime
+}
+
+// Define an SSH key model that wraps around a database connection pool
+type SSHKeyModel struct {
+	DB *sql.DB
+}
+
+// Insert will add a public key to a user. ErrDuplicateSSHKey is returned if
+// any user already added the key.
+func (m *SSHKeyModel) Insert(userID int, name, fingerprint, publicKey string) error {
+	stm := `INSERT INTO ssh_keys (user_id, name, fingerprint, public_key, created)
+	VALUES(?, ?, ?, ?, NOW())`
+
+	_, err := m.DB.Exec(stm, userID, name, fingerprint, publicKey)
+	if err != nil {
+		var MySQLError *mysql.MySQLError
+		if errors.As(err, &MySQLError) && MySQLError.Number == 1062 {
+			return ErrDuplicateSSHKey
+		}
+		return err
+	}
+	return nil
+}
+
+// GetAllForUser will return the keys of a user, newest first
+func (m *SSHKeyModel) GetAllForUser(userID int) ([]*SSHKey, error) {
+	stm := `SELECT id, user_id, name, fingerprint, public_key, created, last_used
+		FROM ssh_keys WHERE user_id=? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stm, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*SSHKey{}
+
+	for rows.Next() {
+		k := &SSHKey{}
+		err = rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Fingerprint, &k.PublicKey, &k.Created, &k.LastUsed)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Authenticate will return the id of the key with the given fingerprint and
+// the id of the user who added it. ErrNoRecord is returned if nobody did.
+// clients offer keys before proving they have them, so this doesn't record
+// that the key was used, Touch does.
+func (m *SSHKeyModel) Authenticate(fingerprint string) (int, int, error) {
+	var id, userID int
+	stm := `SELECT id, user_id FROM ssh_keys WHERE fingerprint=?`
+
+	err := m.DB.QueryRow(stm, fingerprint).Scan(&id, &userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, ErrNoRecord
+		} else {
+			return 0, 0, err
+		}
+	}
+	return id, userID, nil
+}
+
+// Touch will record that the key with the given id was used to log in
+func (m *SSHKeyModel) Touch(id int) error {
+	_, err := m.DB.Exec("UPDATE ssh_keys SET last_used=NOW() WHERE id=?", id)
+	return err
+}
+
+// Delete will remove a key of a user
+func (m *SSHKeyModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec("DELETE FROM ssh_keys WHERE id=? AND user_id=?", id, userID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// the scopes a token can be issued for
+const (
+	ScopePasswordReset = "password-reset"
+	ScopeVerification  = "verification"
+)
+
+// Define a token model that wraps around a database connection pool
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// generateToken returns a random plain-text token and the hex encoded SHA-256
+// hash of it. only the hash is ever stored in the database.
+func generateToken() (string, string, error) {
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", "", err
+	}
+
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	return plaintext, hashToken(plaintext), nil
+}
+
+// RandomString returns a random string that is hard to guess, e.g. to use as
+// a password nobody knows
+func RandomString() (string, error) {
+	plaintext, _, err := generateToken()
+	return plaintext, err
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a plain-text token
+func hashToken(plaintext string) string {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(hash[:])
+}
+
+// New will create a token for the given user and scope which is valid for ttl.
+// It returns the plain-text token which should be sent to the user.
+func (m *TokenModel) New(userID int, scope string, ttl time.Duration) (string, error) {
+	plaintext, hash, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	stm := `INSERT INTO tokens (hash, user_id, scope, expiry)
+	VALUES(?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND))`
+
+	_, err = m.DB.Exec(stm, hash, userID, scope, int(ttl.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// Peek will return the id of the user a non-expired token with the given scope
+// belongs to, without using the token up
+func (m *TokenModel) Peek(plaintext, scope string) (int, error) {
+	var userID int
+	stm := `SELECT user_id FROM tokens WHERE hash=? AND scope=? AND expiry > NOW()`
+
+	err := m.DB.QueryRow(stm, hashToken(plaintext), scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidToken
+		} else {
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+// Consume will look up a non-expired token with the given scope, delete it so
+// it can't be used again and return the id of the user it belongs to
+func (m *TokenModel) Consume(plaintext, scope string) (int, error) {
+	hash := hashToken(plaintext)
+
+	var userID int
+	stm := `SELECT user_id FROM tokens WHERE hash=? AND scope=? AND expiry > NOW()`
+
+	err := m.DB.QueryRow(stm, hash, scope).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidToken
+		} else {
+			return 0, err
+		}
+	}
+
+	// delete the token. if another request consumed it in the meantime no row
+	// is affected and we treat the token as invalid
+	result, err := m.DB.Exec("DELETE FROM tokens WHERE hash=?", hash)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrInvalidToken
+	}
+	return userID, nil
+}
+
+// DeleteAllForUser will remove every token with the given scope for a user
+func (m *TokenModel) DeleteAllForUser(userID int, scope string) error {
+	stm := "DELETE FROM tokens WHERE user_id=? AND scope=?"
+
+	_, err := m.DB.Exec(stm, userID, scope)
+	return err
+}
+
+// CountExpired will return the number of expired tokens that are still stored
+func (m *TokenModel) CountExpired() (int, error) {
+	var count int
+	err := m.DB.QueryRow("SELECT COUNT(*) FROM tokens WHERE expiry <= NOW()").Scan(&count)
+	return count, err
+}
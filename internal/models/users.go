@@ -7,9 +7,23 @@ import (
 	"time"
 
 	"github.com/go-sql-driver/mysql" // New import
-	"golang.org/x/crypto/bcrypt"     // New import
 )
 
+// the roles a user can have. every role can do everything the roles
+// before it can do.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// rank orders the roles from least to most privileged
+var rank = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
 // the user type
 type User struct {
 	ID             int
@@ -17,25 +31,94 @@ type User struct {
 	Email          string
 	HashedParrword []byte
 	Created        time.Time
+	VerifiedAt     sql.NullTime
+	Disabled       bool
+	Role           string
+	InvitedBy      string // only set by Search
+}
+
+// HasRole returns true if the user has the given role or a more privileged one
+func (u *User) HasRole(role string) bool {
+	return rank[u.Role] >= rank[role]
 }
 
-// Define a user model that wraps around a database connection pool
+// Define a user model that wraps around a database connection pool. Hasher
+// hashes new passwords, DefaultPasswordHasher is used if it is nil.
 type UserModel struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Hasher *PasswordHasher
+}
+
+// hasher returns the configured password hasher
+func (m *UserModel) hasher() *PasswordHasher {
+	if m.Hasher == nil {
+		return DefaultPasswordHasher
+	}
+	return m.Hasher
+}
+
+// Insert will add a new user to our users table and return its id
+func (m *UserModel) Insert(name, email, password string) (int, error) {
+	return m.insert(m.DB, name, email, password, 0)
 }
 
-// Insert will add a new user to our users table
-func (m *UserModel) Insert(name, email, password string) error {
+// InsertInvited will add a new user who signed up with an invite code. The
+// code is used up in the same transaction, so a single-use code can't be
+// used twice. ErrInvalidInvite is returned if the code is unknown, expired
+// or used up.
+func (m *UserModel) InsertInvited(name, email, password, code string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	// lock the invite so concurrent signups wait for each other
+	var inviteID int
+	stm := `SELECT id FROM invites WHERE hash=? AND uses < max_uses
+		AND (expires IS NULL OR expires > NOW()) FOR UPDATE`
+
+	err = tx.QueryRow(stm, hashToken(code)).Scan(&inviteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidInvite
+		} else {
+			return 0, err
+		}
+	}
+
+	id, err := m.insert(tx, name, email, password, inviteID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE invites SET uses = uses + 1 WHERE id=?", inviteID)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insert adds the user with the given executor, inviteID is 0 if the user
+// wasn't invited
+func (m *UserModel) insert(db execer, name, email, password string, inviteID int) (int, error) {
 	//create a hash of the plain-text password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hashedPassword, err := m.hasher().Hash(password)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	// mysql query
-	stm := `INSERT INTO users (name, email, hashed_password, created)
-	VALUES(?, ?, ?, NOW())`
+	stm := `INSERT INTO users (name, email, hashed_password, created, invite_id)
+	VALUES(?, ?, ?, NOW(), NULLIF(?, 0))`
 
-	_, err = m.DB.Exec(stm, name, email, string(hashedPassword))
+	result, err := db.Exec(stm, name, email, hashedPassword, inviteID)
 	if err != nil {
 		// we check what type of error happend.
 		// if the error is duplicated email then we return ErrDuplicateEmail error
@@ -43,23 +126,29 @@ func (m *UserModel) Insert(name, email, password string) error {
 		var MySQLError *mysql.MySQLError
 		if errors.As(err, &MySQLError) {
 			if MySQLError.Number == 1062 && strings.Contains(MySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
+				return 0, ErrDuplicateEmail
 			}
 		}
-		return err
+		return 0, err
 	}
-	return nil
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
 }
 
 // Authenticate will check whether a user exist with provided email and password in our database
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	var id int
 	var hashedPassword []byte
+	var disabled bool
 
-	stm := "SELECT id, hashed_password FROM users WHERE email=?"
+	stm := "SELECT id, hashed_password, disabled FROM users WHERE email=?"
 
 	// Retrive the user's id and password
-	err := m.DB.QueryRow(stm, email).Scan(&id, &hashedPassword)
+	err := m.DB.QueryRow(stm, email).Scan(&id, &hashedPassword, &disabled)
 	if err != nil {
 		// check if the record exist or not
 		if errors.Is(err, sql.ErrNoRows) {
@@ -69,18 +158,262 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		}
 	}
 
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	match, needsRehash, err := m.hasher().Verify(password, string(hashedPassword))
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return 0, ErrInvalidCredential
-		} else {
+		return 0, err
+	}
+	if !match {
+		return 0, ErrInvalidCredential
+	}
+
+	// only tell that the account is disabled once the password matched
+	if disabled {
+		return 0, ErrAccountDisabled
+	}
+
+	// this is the only time we know the plain-text password, so we use it to
+	// upgrade hashes made with an outdated algorithm or cost
+	if needsRehash {
+		err = m.UpdatePassword(id, password)
+		if err != nil {
 			return 0, err
 		}
 	}
 	return id, nil
 }
 
-// Exist will check if a user exist with a specific id
+// Provision will create a user whose identity was verified elsewhere, e.g. by
+// a single sign-on provider or a directory. They get a random password, which
+// they can reset if they ever want to log in with a local password.
+func (m *UserModel) Provision(name, email string) (int, error) {
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	password, err := RandomString()
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := m.Insert(name, email, password)
+	if err != nil {
+		return 0, err
+	}
+
+	// the address was already verified where the identity came from
+	err = m.Verify(id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Exist will check if an enabled user exist with a specific id
 func (m *UserModel) Exists(id int) (bool, error) {
-	return true, nil
+	var exists bool
+
+	stm := "SELECT EXISTS(SELECT true FROM users WHERE id=? AND NOT disabled)"
+
+	err := m.DB.QueryRow(stm, id).Scan(&exists)
+	return exists, err
+}
+
+// Get will return the user with the given id
+func (m *UserModel) Get(id int) (*User, error) {
+	stm := "SELECT id, name, email, hashed_password, created, verified_at, disabled, role FROM users WHERE id=?"
+
+	u := &User{}
+	err := m.DB.QueryRow(stm, id).Scan(&u.ID, &u.Name, &u.Email, &u.HashedParrword, &u.Created, &u.VerifiedAt, &u.Disabled, &u.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// GetByEmail will return the user with the given email address
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	stm := "SELECT id, name, email, hashed_password, created, verified_at, disabled, role FROM users WHERE email=?"
+
+	u := &User{}
+	err := m.DB.QueryRow(stm, email).Scan(&u.ID, &u.Name, &u.Email, &u.HashedParrword, &u.Created, &u.VerifiedAt, &u.Disabled, &u.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// UpdatePassword will replace the stored password hash of a user
+func (m *UserModel) UpdatePassword(id int, password string) error {
+	hashedPassword, err := m.hasher().Hash(password)
+	if err != nil {
+		return err
+	}
+
+	stm := "UPDATE users SET hashed_password=? WHERE id=?"
+
+	_, err = m.DB.Exec(stm, hashedPassword, id)
+	return err
+}
+
+// Verify will mark the email address of a user as verified
+func (m *UserModel) Verify(id int) error {
+	stm := "UPDATE users SET verified_at=NOW() WHERE id=? AND verified_at IS NULL"
+
+	_, err := m.DB.Exec(stm, id)
+	return err
+}
+
+// CheckPassword will return ErrInvalidCredential if password isn't the
+// password of the user with the given id
+func (m *UserModel) CheckPassword(id int, password string) error {
+	var hashedPassword []byte
+
+	stm := "SELECT hashed_password FROM users WHERE id=?"
+
+	err := m.DB.QueryRow(stm, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidCredential
+		} else {
+			return err
+		}
+	}
+
+	match, _, err := m.hasher().Verify(password, string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	if !match {
+		return ErrInvalidCredential
+	}
+	return nil
+}
+
+// UpdateProfile will change the name and email of a user. If the email
+// changes, the address has to be verified again.
+func (m *UserModel) UpdateProfile(id int, name, email string) error {
+	stm := `UPDATE users SET name=?,
+		verified_at=IF(email=?, verified_at, NULL), email=?
+		WHERE id=?`
+
+	_, err := m.DB.Exec(stm, name, email, email, id)
+	if err != nil {
+		var MySQLError *mysql.MySQLError
+		if errors.As(err, &MySQLError) {
+			if MySQLError.Number == 1062 && strings.Contains(MySQLError.Message, "users_uc_email") {
+				return ErrDuplicateEmail
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete will remove a user. Their snippets are deleted as well when
+// deleteSnippets is true, otherwise they are kept as anonymous snippets.
+func (m *UserModel) Delete(id int, deleteSnippets bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	if deleteSnippets {
+		_, err = tx.Exec("DELETE FROM snippets WHERE user_id=?", id)
+	} else {
+		_, err = tx.Exec("UPDATE snippets SET user_id=NULL WHERE user_id=?", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM users WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return tx.Commit()
+}
+
+// Search will return up to limit users whose name or email contains query,
+// newest first. an empty query matches every user.
+func (m *UserModel) Search(query string, limit int) ([]*User, error) {
+	stm := `SELECT u.id, u.name, u.email, u.created, u.verified_at, u.disabled, u.role,
+		COALESCE(inviter.name, '')
+		FROM users u
+		LEFT JOIN invites i ON i.id = u.invite_id
+		LEFT JOIN users inviter ON inviter.id = i.created_by
+		WHERE u.name LIKE ? OR u.email LIKE ?
+		ORDER BY u.id DESC LIMIT ?`
+
+	// escape the LIKE wildcards so they are matched literally
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+
+	rows, err := m.DB.Query(stm, pattern, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		u := &User{}
+		err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.VerifiedAt, &u.Disabled, &u.Role, &u.InvitedBy)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Count will return the number of users
+func (m *UserModel) Count() (int, error) {
+	var count int
+	err := m.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
+
+// SetDisabled will disable or enable the account of a user. banning a user
+// who is already banned is not an error.
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	stm := "UPDATE users SET disabled=? WHERE id=?"
+
+	result, err := m.DB.Exec(stm, disabled, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsMatched(m.DB, result, "users", id)
+}
+
+// SetRole will change the role of a user
+func (m *UserModel) SetRole(id int, role string) error {
+	stm := "UPDATE users SET role=? WHERE id=?"
+
+	result, err := m.DB.Exec(stm, role, id)
+	if err != nil {
+		return err
+	}
+	return checkRowsMatched(m.DB, result, "users", id)
 }
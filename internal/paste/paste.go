@@ -0,0 +1,49 @@
+// Package paste holds what the server and the pastely command-line client
+// both need to turn pasted text into a snippet, so they agree on it.
+package paste
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidDays is returned by ParseDays for anything but a positive number
+// of days, weeks or years of at most a year
+var ErrInvalidDays = errors.New("paste: invalid number of days")
+
+// the units ParseDays understands, in days
+var dayUnits = map[string]int{"d": 1, "w": 7, "y": 365}
+
+// ParseDays turns e.g. 7, 7d, 2w or 1y into a number of days. snippets live
+// for a year at most, so longer times are refused.
+func ParseDays(s string) (int, error) {
+	number, unit := s, 1
+	if n := len(s); n > 0 && dayUnits[s[n-1:]] > 0 {
+		number, unit = s[:n-1], dayUnits[s[n-1:]]
+	}
+
+	n, err := strconv.Atoi(number)
+	// checked before multiplying, so huge numbers can't wrap around
+	if err != nil || n < 1 || n > 365/unit {
+		return 0, ErrInvalidDays
+	}
+	return n * unit, nil
+}
+
+// DefaultTitle returns the first line of content, shortened, as the title
+// of a snippet that didn't get one
+func DefaultTitle(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > 50 {
+			line = string([]rune(line)[:50]) + "..."
+		}
+		return line
+	}
+	return "Untitled"
+}
@@ -0,0 +1,65 @@
+package paste
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr error
+	}{
+		{"7", 7, nil},
+		{"1d", 1, nil},
+		{"2w", 14, nil},
+		{"1y", 365, nil},
+		{"365", 365, nil},
+		{"52w", 364, nil},
+		{"366", 0, ErrInvalidDays},
+		{"53w", 0, ErrInvalidDays},
+		{"2y", 0, ErrInvalidDays},
+		{"25269512195121951y", 0, ErrInvalidDays},
+		{"0", 0, ErrInvalidDays},
+		{"-1d", 0, ErrInvalidDays},
+		{"d", 0, ErrInvalidDays},
+		{"1m", 0, ErrInvalidDays},
+		{"", 0, ErrInvalidDays},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDays(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"First line", "hello\nworld", "hello"},
+		{"Blank lines", "\n  \n  hello  \nworld", "hello"},
+		{"Empty", "", "Untitled"},
+		{"Only whitespace", " \n\t\n", "Untitled"},
+		{"Long", strings.Repeat("é", 60), strings.Repeat("é", 50) + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultTitle(tt.content); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Package pow issues and checks proof-of-work challenges. A challenge is a
+// signed string telling the browser how much work to do, so nothing has to be
+// stored until a solution comes back. Solving means finding a nonce such that
+// SHA-256(challenge + ":" + nonce) starts with the given number of zero bits.
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidChallenge = errors.New("pow: invalid challenge")
+
+	ErrExpiredChallenge = errors.New("pow: expired challenge")
+
+	ErrInvalidSolution = errors.New("pow: invalid solution")
+)
+
+// Issuer creates and verifies challenges. The difficulty starts at
+// Difficulty and goes up by one bit, doubling the work, each time the number
+// of challenges solved in the last minute doubles past LoadThreshold. It
+// never goes above MaxDifficulty. Only solved challenges count, so posting
+// garbage doesn't make the challenges harder for everyone else.
+type Issuer struct {
+	Key           []byte
+	Difficulty    int
+	MaxDifficulty int
+	LoadThreshold int
+	TTL           time.Duration
+
+	mu          sync.Mutex
+	window      time.Time
+	count, prev int
+}
+
+// Challenge is a challenge that has been checked by Verify
+type Challenge struct {
+	// ID identifies the challenge, it can be stored to refuse replays
+	ID      string
+	Expires time.Time
+}
+
+// New returns a new challenge. The difficulty is the part before the first
+// dot, so the browser knows when it found a solution.
+func (i *Issuer) New() (string, error) {
+	seed := make([]byte, 16)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+
+	difficulty := i.currentDifficulty()
+	expires := time.Now().Add(i.TTL).Unix()
+
+	payload := fmt.Sprintf("%d.%d.%s", difficulty, expires, hex.EncodeToString(seed))
+	return payload + "." + i.sign(payload), nil
+}
+
+// Verify checks that challenge was issued by i, hasn't expired and that nonce
+// solves it. It doesn't know if the challenge was used before, the caller has
+// to remember the ID until the challenge expires.
+func (i *Issuer) Verify(challenge, nonce string) (*Challenge, error) {
+	payload, signature, ok := cutLast(challenge, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(i.sign(payload))) {
+		return nil, ErrInvalidChallenge
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidChallenge
+	}
+	difficulty, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	c := &Challenge{ID: parts[2], Expires: time.Unix(expires, 0)}
+	if time.Now().After(c.Expires) {
+		return nil, ErrExpiredChallenge
+	}
+
+	if len(nonce) == 0 || len(nonce) > 32 || leadingZeroBits(challenge+":"+nonce) < difficulty {
+		return nil, ErrInvalidSolution
+	}
+
+	i.record()
+	return c, nil
+}
+
+// sign returns the hex encoded HMAC of payload
+func (i *Issuer) sign(payload string) string {
+	mac := hmac.New(sha256.New, i.Key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// record counts a solved challenge in the current one minute window
+func (i *Issuer) record() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.rotate()
+	i.count++
+}
+
+// currentDifficulty returns the difficulty for the load of the last minute
+func (i *Issuer) currentDifficulty() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.rotate()
+	load := max(i.count, i.prev)
+
+	difficulty := i.Difficulty
+	if i.LoadThreshold > 0 {
+		for n := i.LoadThreshold; load >= n && difficulty < i.MaxDifficulty; n *= 2 {
+			difficulty++
+		}
+	}
+	return difficulty
+}
+
+// rotate starts a new window once the current one is a minute old. the count
+// of the previous window is kept so the difficulty doesn't drop all at once.
+func (i *Issuer) rotate() {
+	now := time.Now()
+	if now.Sub(i.window) < time.Minute {
+		return
+	}
+	if now.Sub(i.window) < 2*time.Minute {
+		i.prev = i.count
+	} else {
+		i.prev = 0
+	}
+	i.window = now
+	i.count = 0
+}
+
+// leadingZeroBits returns the number of leading zero bits of SHA-256(s)
+func leadingZeroBits(s string) int {
+	hash := sha256.Sum256([]byte(s))
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,144 @@
+package pow
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// solve returns a nonce that solves challenge
+func solve(t *testing.T, challenge string) string {
+	t.Helper()
+
+	difficulty, err := strconv.Atoi(strings.SplitN(challenge, ".", 2)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; ; n++ {
+		nonce := strconv.Itoa(n)
+		if leadingZeroBits(challenge+":"+nonce) >= difficulty {
+			return nonce
+		}
+	}
+}
+
+// unsolve returns a nonce that doesn't solve challenge
+func unsolve(t *testing.T, challenge string) string {
+	t.Helper()
+
+	difficulty, _ := strconv.Atoi(strings.SplitN(challenge, ".", 2)[0])
+	for n := 0; ; n++ {
+		nonce := strconv.Itoa(n)
+		if leadingZeroBits(challenge+":"+nonce) < difficulty {
+			return nonce
+		}
+	}
+}
+
+func newTestIssuer() *Issuer {
+	return &Issuer{Key: []byte("secret"), Difficulty: 8, MaxDifficulty: 12, LoadThreshold: 4, TTL: time.Minute}
+}
+
+func TestVerify(t *testing.T) {
+	issuer := newTestIssuer()
+
+	challenge, err := issuer.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := solve(t, challenge)
+
+	other := &Issuer{Key: []byte("other"), Difficulty: 8, TTL: time.Minute}
+	foreign, _ := other.New()
+
+	expired := &Issuer{Key: []byte("secret"), Difficulty: 8, TTL: -time.Minute}
+	old, _ := expired.New()
+
+	// the difficulty is signed, so lowering it breaks the signature
+	payload, signature, _ := cutLast(challenge, ".")
+	easier := "0" + payload[strings.Index(payload, "."):] + "." + signature
+
+	tests := []struct {
+		name      string
+		challenge string
+		nonce     string
+		wantErr   error
+	}{
+		{"Valid", challenge, nonce, nil},
+		{"Wrong nonce", challenge, unsolve(t, challenge), ErrInvalidSolution},
+		{"Empty nonce", challenge, "", ErrInvalidSolution},
+		{"Long nonce", challenge, strings.Repeat("0", 33), ErrInvalidSolution},
+		{"Other key", foreign, solve(t, foreign), ErrInvalidChallenge},
+		{"Expired", old, solve(t, old), ErrExpiredChallenge},
+		{"Lowered difficulty", easier, "0", ErrInvalidChallenge},
+		{"Garbage", "garbage", "0", ErrInvalidChallenge},
+		{"Empty", "", "", ErrInvalidChallenge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := issuer.Verify(tt.challenge, tt.nonce)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && c.ID == "" {
+				t.Error("got a challenge without an ID")
+			}
+		})
+	}
+}
+
+// only solved challenges count as load, so garbage can't raise the difficulty
+func TestVerifyLoad(t *testing.T) {
+	issuer := newTestIssuer()
+
+	for n := 0; n < 100; n++ {
+		issuer.Verify("garbage", "0")
+		challenge, _ := issuer.New()
+		issuer.Verify(challenge, unsolve(t, challenge))
+	}
+	if d := issuer.currentDifficulty(); d != issuer.Difficulty {
+		t.Fatalf("got difficulty %d after failed attempts; want %d", d, issuer.Difficulty)
+	}
+
+	for n := 0; n < issuer.LoadThreshold; n++ {
+		challenge, _ := issuer.New()
+		if _, err := issuer.Verify(challenge, solve(t, challenge)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := issuer.currentDifficulty(); d != issuer.Difficulty+1 {
+		t.Fatalf("got difficulty %d after %d solutions; want %d", d, issuer.LoadThreshold, issuer.Difficulty+1)
+	}
+}
+
+func TestCurrentDifficulty(t *testing.T) {
+	tests := []struct {
+		load int
+		want int
+	}{
+		{0, 8},
+		{3, 8},
+		{4, 9},
+		{7, 9},
+		{8, 10},
+		{16, 11},
+		{32, 12},
+		{1000, 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.load), func(t *testing.T) {
+			issuer := newTestIssuer()
+			issuer.window = time.Now()
+			issuer.count = tt.load
+
+			if d := issuer.currentDifficulty(); d != tt.want {
+				t.Errorf("got difficulty %d; want %d", d, tt.want)
+			}
+		})
+	}
+}
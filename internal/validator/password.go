@@ -0,0 +1,184 @@
+package validator
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy decides whether a password is good enough. Check returns
+// feedback messages explaining what is wrong with a password, if anything.
+type PasswordPolicy struct {
+	MinLength  int
+	MinEntropy float64 // estimated bits of entropy
+	Breached   *BreachedPasswords
+}
+
+// DefaultPasswordPolicy is used by handlers when no policy is configured
+var DefaultPasswordPolicy = &PasswordPolicy{
+	MinLength:  8,
+	MinEntropy: 40,
+}
+
+// a few passwords that are so common they are rejected even without a
+// breached password list
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "12345678": true,
+	"123456789": true, "1234567890": true, "qwerty123": true, "qwertyuiop": true,
+	"iloveyou": true, "sunshine": true, "princess": true, "football": true,
+	"baseball": true, "welcome1": true, "letmein1": true, "trustno1": true,
+	"superman": true, "starwars": true, "passw0rd": true, "11111111": true,
+}
+
+// Check returns feedback for every problem found with password. name and
+// email are the user's own details, which the password must not contain.
+func (p *PasswordPolicy) Check(password, name, email string) []string {
+	var feedback []string
+	lower := strings.ToLower(password)
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		feedback = append(feedback, "Use at least "+strconv.Itoa(p.MinLength)+" characters.")
+	}
+
+	if containsPersonalInfo(lower, name, email) {
+		feedback = append(feedback, "Don't use your name or email address in your password.")
+	}
+
+	if commonPasswords[lower] || (p.Breached != nil && p.Breached.Contains(password)) {
+		feedback = append(feedback, "This password has appeared in a data breach and can't be used, please choose another one.")
+	} else if EstimateEntropy(password) < p.MinEntropy {
+		feedback = append(feedback, "This password is too easy to guess. Make it longer, mix upper and lower case letters, numbers and symbols, and avoid repeated characters and sequences like abc or 123.")
+	}
+
+	return feedback
+}
+
+// containsPersonalInfo returns true if the lowercased password contains the
+// name, any word of it, or the local part of the email address
+func containsPersonalInfo(lower, name, email string) bool {
+	parts := strings.Fields(strings.ToLower(name))
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok {
+		parts = append(parts, local)
+	}
+
+	for _, part := range parts {
+		// very short parts like initials would match too many passwords
+		if utf8.RuneCountInString(part) >= 3 && strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// EstimateEntropy returns a rough estimate of the bits of entropy of password,
+// based on the kinds of characters it uses. characters that repeat the
+// previous one or continue a sequence (abc, 321) only count for half.
+func EstimateEntropy(password string) float64 {
+	var hasLower, hasUpper, hasDigit, hasSymbol, hasOther bool
+	var length float64
+	var prev rune = -1
+
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			hasLower = true
+		case r >= 'A' && r <= 'Z':
+			hasUpper = true
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			hasSymbol = true
+		default:
+			hasOther = true
+		}
+
+		d := unicode.ToLower(r) - unicode.ToLower(prev)
+		if prev != -1 && (d == 0 || d == 1 || d == -1) {
+			length += 0.5
+		} else {
+			length++
+		}
+		prev = r
+	}
+
+	pool := 0
+	if hasLower {
+		pool += 26
+	}
+	if hasUpper {
+		pool += 26
+	}
+	if hasDigit {
+		pool += 10
+	}
+	if hasSymbol {
+		pool += 33
+	}
+	if hasOther {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	return length * math.Log2(float64(pool))
+}
+
+// BreachedPasswords is a set of SHA-1 hashes of passwords known from data
+// breaches. it is loaded from a local file so no network access is needed.
+// every hash is kept in memory, so it is meant for a list of the most common
+// breached passwords, e.g. the top few million. the whole Have I Been Pwned
+// corpus has close to a billion hashes and doesn't fit.
+type BreachedPasswords struct {
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+// LoadBreachedPasswords reads a file with one hex encoded SHA-1 hash per line.
+// The "HASH:COUNT" lines of the Have I Been Pwned downloads work as well, so
+// the most frequent lines of a download can be used as they are.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := &BreachedPasswords{hashes: make(map[[sha1.Size]byte]struct{})}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+
+		// skip blank lines and anything that isn't a hash
+		if len(line) != hex.EncodedLen(sha1.Size) {
+			continue
+		}
+		var hash [sha1.Size]byte
+		if _, err := hex.Decode(hash[:], []byte(line)); err != nil {
+			continue
+		}
+		b.hashes[hash] = struct{}{}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Contains returns true if password is in the breached password list
+func (b *BreachedPasswords) Contains(password string) bool {
+	_, ok := b.hashes[sha1.Sum([]byte(password))]
+	return ok
+}
+
+// Len returns the number of hashes in the list
+func (b *BreachedPasswords) Len() int {
+	return len(b.hashes)
+}
@@ -0,0 +1,118 @@
+package validator
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	feedbackLength   = "Use at least 8 characters."
+	feedbackPersonal = "Don't use your name or email address in your password."
+	feedbackBreached = "This password has appeared in a data breach and can't be used, please choose another one."
+	feedbackGuess    = "This password is too easy to guess. Make it longer, mix upper and lower case letters, numbers and symbols, and avoid repeated characters and sequences like abc or 123."
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	breached := writeBreachedPasswords(t, "Zebra-Lamp-42!", "another one")
+
+	policy := &PasswordPolicy{MinLength: 8, MinEntropy: 40, Breached: breached}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"Strong", "Tr0ub4dor&3x", nil},
+		{"Long passphrase", "correct horse battery staple", nil},
+		{"Empty", "", []string{feedbackLength, feedbackGuess}},
+		{"Short", "Xk9#", []string{feedbackLength, feedbackGuess}},
+		{"Common", "password", []string{feedbackBreached}},
+		{"Common in upper case", "PASSWORD", []string{feedbackBreached}},
+		{"Sequence", "abcdefghij", []string{feedbackGuess}},
+		{"Repeated", "zzzzzzzzzzzz", []string{feedbackGuess}},
+		{"Name", "Alice-Gr33n-1999!", []string{feedbackPersonal}},
+		{"Email", "x!bobby.t@9Q#", []string{feedbackPersonal}},
+		{"Breached list", "Zebra-Lamp-42!", []string{feedbackBreached}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Check(tt.password, "Alice Green", "bobby.t@example.com")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		min, max float64
+	}{
+		{"", 0, 0},
+		{"aaaa", 0, 12},
+		{"abcd", 0, 12},
+		{"kx7q", 16, 24},
+		{"Tr0ub4dor&3x", 70, 80},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got := EstimateEntropy(tt.password)
+			if got < tt.min || got > tt.max {
+				t.Errorf("got %.1f bits; want between %.0f and %.0f", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// the list can have plain hashes and the HASH:COUNT lines of Have I Been Pwned
+func TestLoadBreachedPasswords(t *testing.T) {
+	b := writeBreachedPasswords(t, "Zebra-Lamp-42!", "another one")
+
+	if b.Len() != 2 {
+		t.Errorf("got %d hashes; want 2", b.Len())
+	}
+	for _, password := range []string{"Zebra-Lamp-42!", "another one"} {
+		if !b.Contains(password) {
+			t.Errorf("got %q not contained; want it contained", password)
+		}
+	}
+	if b.Contains("zebra-lamp-42!") {
+		t.Error("got a different password contained")
+	}
+}
+
+// writeBreachedPasswords loads a list with the hashes of the given passwords.
+// the first one is a plain lower case hash, the rest are HIBP lines.
+func writeBreachedPasswords(t *testing.T, passwords ...string) *BreachedPasswords {
+	t.Helper()
+
+	lines := []string{"", "not a hash"}
+	for i, password := range passwords {
+		hash := sha1.Sum([]byte(password))
+		if i == 0 {
+			lines = append(lines, hex.EncodeToString(hash[:]))
+		} else {
+			lines = append(lines, strings.ToUpper(hex.EncodeToString(hash[:]))+":42")
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
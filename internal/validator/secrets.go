@@ -0,0 +1,139 @@
+package validator
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecretMatch describes a secret found in a piece of text. Start and End are
+// byte offsets, so value[Start:End] is the secret itself.
+type SecretMatch struct {
+	Kind  string
+	Start int
+	End   int
+}
+
+// secretPattern is a known token format. if group is set, only that
+// submatch is the secret and the rest of the match is just context.
+type secretPattern struct {
+	kind  string
+	rx    *regexp.Regexp
+	group int
+}
+
+// the known token formats, compiled once at startup like EmailRX
+var secretPatterns = []secretPattern{
+	{"PEM private key", regexp.MustCompile(`-----BEGIN[A-Z ]* PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END[A-Z ]* PRIVATE KEY( BLOCK)?-----`), 0},
+	{"AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`), 0},
+	{"AWS secret access key", regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|private)?.{0,20}?['"=:\s]([0-9a-zA-Z/+]{40})\b`), 1},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,255}\b`), 0},
+	{"GitHub fine-grained token", regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{82}\b`), 0},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`), 0},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), 0},
+	{"Pastely access token", regexp.MustCompile(`\bpst_[A-Z2-7]{26}\b`), 0},
+	{"Stripe secret key", regexp.MustCompile(`\b[rs]k_live_[0-9a-zA-Z]{24,}\b`), 0},
+}
+
+// candidates for the high-entropy heuristic: long runs of base64 or base64url
+// characters
+var entropyCandidateRX = regexp.MustCompile(`[A-Za-z0-9+/_\-]{32,}={0,2}`)
+
+// the minimum Shannon entropy, in bits per character, for a candidate to be
+// reported. random base64 is close to 6, English words and identifiers
+// usually stay well below 4. hex can't have more than 4, so hex-only secrets
+// are only found by the known token formats. that is on purpose, as commit
+// hashes and checksums are hex as well and are pasted all the time.
+const minSecretEntropy = 4.5
+
+// ScanSecrets returns the secrets found in value, ordered by position. Known
+// token formats are matched first, then any remaining long random-looking
+// string is reported as a high-entropy string.
+func ScanSecrets(value string) []SecretMatch {
+	var matches []SecretMatch
+
+	overlaps := func(start, end int) bool {
+		for _, m := range matches {
+			if start < m.End && end > m.Start {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, p := range secretPatterns {
+		for _, loc := range p.rx.FindAllStringSubmatchIndex(value, -1) {
+			start, end := loc[2*p.group], loc[2*p.group+1]
+			if !overlaps(start, end) {
+				matches = append(matches, SecretMatch{Kind: p.kind, Start: start, End: end})
+			}
+		}
+	}
+
+	for _, loc := range entropyCandidateRX.FindAllStringIndex(value, -1) {
+		candidate := value[loc[0]:loc[1]]
+		if overlaps(loc[0], loc[1]) || !looksRandom(candidate) {
+			continue
+		}
+		matches = append(matches, SecretMatch{Kind: "high-entropy string", Start: loc[0], End: loc[1]})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+	return matches
+}
+
+// looksRandom returns true if s mixes letters and digits and has a high entropy
+func looksRandom(s string) bool {
+	hasDigit := strings.ContainsAny(s, "0123456789")
+	hasLetter := strings.ContainsFunc(s, func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	})
+	return hasDigit && hasLetter && shannonEntropy(s) >= minSecretEntropy
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	var entropy float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// RedactSecrets returns value with every match replaced by a placeholder
+// naming the kind of secret that was removed
+func RedactSecrets(value string, matches []SecretMatch) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(value[last:m.Start])
+		b.WriteString("[REDACTED " + m.Kind + "]")
+		last = m.End
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// SecretKinds returns the distinct kinds of the matches, in order of appearance
+func SecretKinds(matches []SecretMatch) []string {
+	var kinds []string
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		if !seen[m.Kind] {
+			seen[m.Kind] = true
+			kinds = append(kinds, m.Kind)
+		}
+	}
+	return kinds
+}
@@ -73,6 +73,31 @@ func PermittedInt(value int, permittedValues ...int) bool {
 	return false
 }
 
+// returns true if a value is in a list of permitted string list
+func PermittedString(value string, permittedValues ...string) bool {
+	for i := range permittedValues {
+		if value == permittedValues[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// returns true if the domain of an email address is one of the given domains
+func EmailDomainIn(email string, domains ...string) bool {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false
+	}
+	domain := email[i+1:]
+	for i := range domains {
+		if strings.EqualFold(domain, domains[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 // return true if a string matches a provided compiled regular expression pattern
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
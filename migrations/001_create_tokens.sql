@@ -0,0 +1,11 @@
+-- tokens holds single-use, expiring tokens that are mailed to users. Only
+-- the SHA-256 hash of the token is stored, never the plain-text value.
+CREATE TABLE tokens (
+    hash CHAR(64) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    scope VARCHAR(32) NOT NULL,
+    expiry DATETIME NOT NULL,
+    CONSTRAINT tokens_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_tokens_user_scope ON tokens(user_id, scope);
@@ -0,0 +1,6 @@
+-- verified_at is set once the user has followed the link emailed at signup.
+-- it stays NULL for addresses that haven't been verified yet.
+ALTER TABLE users ADD COLUMN verified_at DATETIME NULL;
+
+-- accounts that existed before verification was introduced are trusted
+UPDATE users SET verified_at = created;
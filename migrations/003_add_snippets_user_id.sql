@@ -0,0 +1,4 @@
+-- user_id records who created a snippet. it is NULL for anonymous snippets,
+-- including the ones left behind by an account that was deleted.
+ALTER TABLE snippets ADD COLUMN user_id INTEGER NULL;
+ALTER TABLE snippets ADD CONSTRAINT snippets_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
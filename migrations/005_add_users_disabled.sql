@@ -0,0 +1,2 @@
+-- disabled accounts can't log in and their existing sessions stop working
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
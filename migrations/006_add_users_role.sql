@@ -0,0 +1,2 @@
+-- role decides what a user is allowed to do, see models.Role*
+ALTER TABLE users ADD COLUMN role ENUM('user', 'moderator', 'admin') NOT NULL DEFAULT 'user';
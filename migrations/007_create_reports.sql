@@ -0,0 +1,19 @@
+-- hidden snippets are kept out of sight while a moderator reviews them
+ALTER TABLE snippets ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- reports are abuse reports on snippets, waiting in the moderation queue
+-- until a moderator dismisses them or removes the snippet
+CREATE TABLE reports (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    reason VARCHAR(500) NOT NULL,
+    reporter_ip VARCHAR(45) NOT NULL,
+    reporter_id INTEGER NULL,
+    status ENUM('open', 'dismissed') NOT NULL DEFAULT 'open',
+    created DATETIME NOT NULL,
+    CONSTRAINT reports_fk_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT reports_fk_user FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_reports_status ON reports(status);
+CREATE INDEX idx_reports_ip_created ON reports(reporter_ip, created);
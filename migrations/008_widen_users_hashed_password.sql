@@ -0,0 +1,3 @@
+-- argon2id hashes in PHC string format are longer than the 60 characters of
+-- a bcrypt hash
+ALTER TABLE users MODIFY hashed_password VARCHAR(255) NOT NULL;
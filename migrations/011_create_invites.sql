@@ -0,0 +1,19 @@
+-- invites are codes an admin hands out so people can sign up when the site
+-- is in invite-only mode. only the SHA-256 hash of the code is stored.
+CREATE TABLE invites (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    hash CHAR(64) NOT NULL,
+    note VARCHAR(100) NOT NULL,
+    created_by INTEGER NULL,
+    max_uses INTEGER NOT NULL,
+    uses INTEGER NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    expires DATETIME NULL,
+    CONSTRAINT invites_uc_hash UNIQUE (hash),
+    CONSTRAINT invites_fk_user FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- invite_id records which invite a user signed up with, and through it who
+-- invited them
+ALTER TABLE users ADD COLUMN invite_id INTEGER NULL;
+ALTER TABLE users ADD CONSTRAINT users_fk_invite FOREIGN KEY (invite_id) REFERENCES invites(id) ON DELETE SET NULL;
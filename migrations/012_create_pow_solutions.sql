@@ -0,0 +1,9 @@
+-- pow_solutions remembers the proof-of-work challenges that were already
+-- used, so a solved challenge can't be replayed. rows can be removed once
+-- the challenge has expired.
+CREATE TABLE pow_solutions (
+    id CHAR(32) NOT NULL PRIMARY KEY,
+    expires DATETIME NOT NULL
+);
+
+CREATE INDEX idx_pow_solutions_expires ON pow_solutions(expires);
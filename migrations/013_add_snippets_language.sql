@@ -0,0 +1,4 @@
+-- language is the optional programming language of a snippet, e.g. "go".
+-- content is widened so that whole build logs can be pasted.
+ALTER TABLE snippets ADD COLUMN language VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE snippets MODIFY content MEDIUMTEXT NOT NULL;
@@ -0,0 +1,3 @@
+-- unlisted snippets are left out of the lists of latest snippets, private
+-- snippets are only shown to their owner, see models.Visibility*
+ALTER TABLE snippets ADD COLUMN visibility ENUM('public', 'unlisted', 'private') NOT NULL DEFAULT 'public';
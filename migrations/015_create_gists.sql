@@ -0,0 +1,15 @@
+-- gists group snippets, one per file, for the GitHub Gist API. the title of
+-- each snippet is its file name. like snippets, gists become anonymous when
+-- the account of their owner is deleted.
+CREATE TABLE gists (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    public BOOLEAN NOT NULL,
+    created DATETIME NOT NULL,
+    updated DATETIME NOT NULL,
+    CONSTRAINT gists_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+ALTER TABLE snippets ADD COLUMN gist_id INTEGER NULL;
+ALTER TABLE snippets ADD CONSTRAINT snippets_fk_gist FOREIGN KEY (gist_id) REFERENCES gists(id) ON DELETE CASCADE;
@@ -0,0 +1,14 @@
+-- ssh_keys are the public keys users paste with over SSH. fingerprint is
+-- the SHA256 fingerprint the SSH server looks keys up by, public_key is the
+-- key in authorized_keys format.
+CREATE TABLE ssh_keys (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    fingerprint VARCHAR(100) NOT NULL,
+    public_key TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    last_used DATETIME NULL,
+    CONSTRAINT ssh_keys_uc_fingerprint UNIQUE (fingerprint),
+    CONSTRAINT ssh_keys_fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+-- login_attempts records failed logins, so guessing passwords can be slowed
+-- down per account and per IP address. rows older than a day are removed.
+CREATE TABLE login_attempts (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    email VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_login_attempts_email_created ON login_attempts(email, created);
+CREATE INDEX idx_login_attempts_ip_created ON login_attempts(ip, created);
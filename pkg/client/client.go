@@ -0,0 +1,159 @@
+// Package client is a Go client for the Pastely JSON API.
+//
+//	c := client.New("https://pastely.example.com", os.Getenv("PASTELY_TOKEN"))
+//	snippet, err := c.CreateSnippet(ctx, client.NewSnippet{Title: "build.log", Content: log})
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(snippet.URL)
+//
+// Requests that fail with 429 Too Many Requests or a 5xx status are retried.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API of a Pastely server. Its zero value isn't usable,
+// create one with New.
+type Client struct {
+	// BaseURL is the URL of the server, e.g. https://pastely.example.com
+	BaseURL string
+	// Token is a personal access token. requests are anonymous without it.
+	Token string
+	// HTTPClient sends the requests, http.DefaultClient is used if it is nil
+	HTTPClient *http.Client
+	// MaxRetries is how often a failed request is retried
+	MaxRetries int
+	// UserAgent is sent with every request
+	UserAgent string
+}
+
+// New returns a client for the server at baseURL authenticating with token,
+// which may be empty
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		MaxRetries: 3,
+		UserAgent:  "pastely-go-client",
+	}
+}
+
+// do sends a request with the JSON encoding of body, if it isn't nil, and
+// decodes the JSON response into dst, if it isn't nil
+func (c *Client) do(ctx context.Context, method, path string, body, dst any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, payload)
+		if err != nil {
+			return err
+		}
+
+		if c.retryable(method, resp.StatusCode) && attempt < c.MaxRetries {
+			delay := retryDelay(resp, attempt)
+			resp.Body.Close()
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		return decodeResponse(resp, dst)
+	}
+}
+
+// send sends a single request
+func (c *Client) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// retryable returns true if a request that got status should be sent again.
+// POST isn't idempotent, so it is only retried when the server turned it
+// away before doing anything.
+func (c *Client) retryable(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	return status >= 500 && method != http.MethodPost
+}
+
+// retryDelay returns how long to wait before the next attempt. the server's
+// Retry-After header wins, otherwise the delay doubles with every attempt.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return min(500*time.Millisecond<<attempt, 10*time.Second)
+}
+
+// decodeResponse decodes a successful response into dst or returns an *Error
+func decodeResponse(resp *http.Response, dst any) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if dst == nil {
+			return nil
+		}
+		err := json.NewDecoder(resp.Body).Decode(dst)
+		if err != nil {
+			return fmt.Errorf("client: decoding response: %w", err)
+		}
+		return nil
+	}
+
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	var body struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+		apiErr.Message = body.Error
+		apiErr.Fields = body.Fields
+	} else {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
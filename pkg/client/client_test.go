@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a client for a server answering with the given
+// statuses in turn, the last one for every request after that. it also
+// returns the number of requests the server got.
+func newTestServer(t *testing.T, statuses ...int) (*Client, *atomic.Int32) {
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(status)
+		if status >= 400 {
+			io.WriteString(w, `{"error": "failed"}`)
+		} else {
+			io.WriteString(w, `{"snippet": {"id": 1}}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	c := New(srv.URL, "token")
+	c.MaxRetries = 2
+	return c, &requests
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int
+		wantStatus   int
+		wantRequests int32
+	}{
+		{"Success", http.MethodGet, []int{200}, 0, 1},
+		{"Retried server error", http.MethodGet, []int{503, 200}, 0, 2},
+		{"Too many server errors", http.MethodGet, []int{503}, 503, 3},
+		{"Server error on POST", http.MethodPost, []int{503, 200}, 503, 1},
+		{"Too many requests on POST", http.MethodPost, []int{429, 200}, 0, 2},
+		{"Client error", http.MethodGet, []int{404, 200}, 404, 1},
+		{"Retried PATCH", http.MethodPatch, []int{502, 500, 200}, 0, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, requests := newTestServer(t, tt.statuses...)
+
+			var resp snippetResponse
+			err := c.do(context.Background(), tt.method, "/api/v1/snippets/1", nil, &resp)
+
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d requests; want %d", got, tt.wantRequests)
+			}
+
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("got error %v; want none", err)
+				}
+				if resp.Snippet == nil || resp.Snippet.ID != 1 {
+					t.Errorf("got snippet %+v; want id 1", resp.Snippet)
+				}
+				return
+			}
+
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("got error %v; want an *Error", err)
+			}
+			if apiErr.StatusCode != tt.wantStatus || apiErr.Message != "failed" {
+				t.Errorf("got %d %q; want %d %q", apiErr.StatusCode, apiErr.Message, tt.wantStatus, "failed")
+			}
+		})
+	}
+}
+
+// a retry doesn't outlive the context of the request
+func TestClientRetryContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := New(srv.URL, "").GetSnippet(ctx, 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, ErrNoRecord},
+		{http.StatusUnauthorized, ErrInvalidCredential},
+		{http.StatusConflict, ErrDuplicateEmail},
+		{http.StatusForbidden, nil},
+		{http.StatusUnprocessableEntity, nil},
+		{http.StatusInternalServerError, nil},
+	}
+
+	sentinels := []error{ErrNoRecord, ErrInvalidCredential, ErrDuplicateEmail}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := error(&Error{StatusCode: tt.status, Message: "failed"})
+
+			if got := errors.Unwrap(err); got != tt.want {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+			for _, sentinel := range sentinels {
+				want := sentinel == tt.want
+				if got := errors.Is(err, sentinel); got != want {
+					t.Errorf("got errors.Is(err, %v) %t; want %t", sentinel, got, want)
+				}
+			}
+		})
+	}
+}
+
+// validation errors keep the messages of the fields
+func TestDecodeValidationError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		io.WriteString(w, `{"error": "the request contains invalid fields", "fields": {"title": "This field cannot be blank"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "token").CreateSnippet(context.Background(), NewSnippet{})
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got error %v; want an *Error", err)
+	}
+	if apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Fields["title"] != "This field cannot be blank" {
+		t.Errorf("got %+v; want 422 with a title error", apiErr)
+	}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// These errors mirror the errors of the server's models. Use errors.Is to
+// check for them, e.g. errors.Is(err, client.ErrNoRecord).
+var (
+	ErrNoRecord = errors.New("client: no matching record found")
+
+	ErrInvalidCredential = errors.New("client: invalid credentials")
+
+	ErrDuplicateEmail = errors.New("client: duplicate email")
+)
+
+// Error is an error response of the API. Use errors.As to get at it.
+type Error struct {
+	StatusCode int
+	Message    string
+	// the error messages of invalid request fields, by field name
+	Fields map[string]string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("client: %d %s", e.StatusCode, e.Message)
+	if len(e.Fields) > 0 {
+		fields := make([]string, 0, len(e.Fields))
+		for name, message := range e.Fields {
+			fields = append(fields, name+": "+message)
+		}
+		msg += " (" + strings.Join(fields, ", ") + ")"
+	}
+	return msg
+}
+
+// Unwrap returns the error of the models the status code stands for, if any
+func (e *Error) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return ErrNoRecord
+	case http.StatusUnauthorized:
+		return ErrInvalidCredential
+	case http.StatusConflict:
+		return ErrDuplicateEmail
+	}
+	return nil
+}
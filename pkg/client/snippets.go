@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Snippet is a snippet as returned by the API
+type Snippet struct {
+	ID      int       `json:"id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+	// Owner is the id of the user who created the snippet, 0 if anonymous
+	Owner    int    `json:"owner,omitempty"`
+	Language string `json:"language,omitempty"`
+	URL      string `json:"url"`
+}
+
+// NewSnippet holds the fields of a snippet to create
+type NewSnippet struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// Expires is the number of days until the snippet expires: 1, 7 or 365.
+	// 0 uses the server's default.
+	Expires  int    `json:"expires,omitempty"`
+	Language string `json:"language,omitempty"`
+	// ConfirmSecrets publishes the snippet even if the server thinks it
+	// contains secrets such as keys or tokens
+	ConfirmSecrets bool `json:"confirm_secrets,omitempty"`
+}
+
+// SnippetUpdate holds the fields of a snippet to change, nil fields are kept
+type SnippetUpdate struct {
+	Title   *string `json:"title,omitempty"`
+	Content *string `json:"content,omitempty"`
+	// Expires is the number of days from now until the snippet expires
+	Expires        *int    `json:"expires,omitempty"`
+	Language       *string `json:"language,omitempty"`
+	ConfirmSecrets bool    `json:"confirm_secrets,omitempty"`
+}
+
+// ListOptions selects the snippets ListSnippets returns
+type ListOptions struct {
+	// Page starts at 1, 0 is the first page
+	Page int
+	// PageSize is at most 100, 0 uses the server's default
+	PageSize int
+	// Mine only lists the snippets of the owner of the token
+	Mine bool
+}
+
+// snippetResponse is the envelope of a single snippet
+type snippetResponse struct {
+	Snippet *Snippet `json:"snippet"`
+}
+
+// CreateSnippet creates a snippet owned by the owner of the token, which
+// needs the snippets:write scope
+func (c *Client) CreateSnippet(ctx context.Context, snippet NewSnippet) (*Snippet, error) {
+	var resp snippetResponse
+	err := c.do(ctx, http.MethodPost, "/api/v1/snippets", snippet, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Snippet, nil
+}
+
+// GetSnippet returns the snippet with the given id, or ErrNoRecord if there
+// is none or it has expired
+func (c *Client) GetSnippet(ctx context.Context, id int) (*Snippet, error) {
+	var resp snippetResponse
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/snippets/%d", id), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Snippet, nil
+}
+
+// ListSnippets returns the latest snippets, newest first
+func (c *Client) ListSnippets(ctx context.Context, opts ListOptions) ([]*Snippet, error) {
+	query := url.Values{}
+	if opts.Page > 0 {
+		query.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.PageSize > 0 {
+		query.Set("page_size", strconv.Itoa(opts.PageSize))
+	}
+	if opts.Mine {
+		query.Set("mine", "true")
+	}
+
+	path := "/api/v1/snippets"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var resp struct {
+		Snippets []*Snippet `json:"snippets"`
+	}
+	err := c.do(ctx, http.MethodGet, path, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Snippets, nil
+}
+
+// UpdateSnippet changes one of the token owner's snippets, which needs the
+// snippets:write scope
+func (c *Client) UpdateSnippet(ctx context.Context, id int, update SnippetUpdate) (*Snippet, error) {
+	var resp snippetResponse
+	err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/v1/snippets/%d", id), update, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Snippet, nil
+}
+
+// DeleteSnippet deletes one of the token owner's snippets, which needs the
+// snippets:delete scope
+func (c *Client) DeleteSnippet(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/snippets/%d", id), nil, nil)
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// the scopes a token can be granted
+const (
+	ScopeSnippetsRead   = "snippets:read"
+	ScopeSnippetsWrite  = "snippets:write"
+	ScopeSnippetsDelete = "snippets:delete"
+	ScopeAccountWrite   = "account:write"
+)
+
+// User is a user as returned by the API
+type User struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email"`
+	Created time.Time `json:"created"`
+	// Verified is true once the email address has been verified
+	Verified bool   `json:"verified"`
+	Role     string `json:"role"`
+}
+
+// UserUpdate holds the fields of a user to change, nil fields are kept
+type UserUpdate struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+	// CurrentPassword is needed to change the email address
+	CurrentPassword string `json:"current_password,omitempty"`
+}
+
+// NewToken holds the credentials and settings of a token to create
+type NewToken struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Name helps to recognise the token on the account page
+	Name string `json:"name"`
+	// Scopes defaults to every scope but ScopeAccountWrite
+	Scopes []string `json:"scopes,omitempty"`
+	// Expires is the number of days until the token expires: 30, 90 or
+	// 365. 0 uses the server's default.
+	Expires int `json:"expires,omitempty"`
+}
+
+// Token is a newly created personal access token
+type Token struct {
+	Token  string   `json:"token"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// userResponse is the envelope of a single user
+type userResponse struct {
+	User *User `json:"user"`
+}
+
+// CurrentUser returns the owner of the token
+func (c *Client) CurrentUser(ctx context.Context) (*User, error) {
+	var resp userResponse
+	err := c.do(ctx, http.MethodGet, "/api/v1/users/me", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.User, nil
+}
+
+// UpdateCurrentUser changes the name or email of the owner of the token,
+// which needs the account:write scope. A new email address also needs the
+// current password. It returns ErrDuplicateEmail if another user has the
+// email address.
+func (c *Client) UpdateCurrentUser(ctx context.Context, update UserUpdate) (*User, error) {
+	var resp userResponse
+	err := c.do(ctx, http.MethodPatch, "/api/v1/users/me", update, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.User, nil
+}
+
+// CreateToken logs in with an email and password and returns a new personal
+// access token. It returns ErrInvalidCredential if they don't match. The
+// client's own token isn't changed.
+func (c *Client) CreateToken(ctx context.Context, token NewToken) (*Token, error) {
+	var resp struct {
+		Token *Token `json:"token"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/tokens", token, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Token, nil
+}
@@ -0,0 +1,141 @@
+// a small explorer for the JSON API. it reads the OpenAPI document and shows
+// a form for every operation that sends the request and prints the response.
+// everything is built with DOM calls, so it works with the strict CSP.
+(function () {
+	var container = document.getElementById("api-explorer");
+	var tokenInput = document.querySelector("#api-explorer-token input[name='token']");
+
+	function element(tag, text, className) {
+		var el = document.createElement(tag);
+		if (text) {
+			el.textContent = text;
+		}
+		if (className) {
+			el.className = className;
+		}
+		return el;
+	}
+
+	function schemaFor(doc, ref) {
+		return doc.components.schemas[ref.split("/").pop()];
+	}
+
+	// an example request body with every property of the schema
+	function exampleBody(schema) {
+		var example = {};
+		var properties = schema.properties || {};
+		for (var name in properties) {
+			var property = properties[name];
+			if (property.default !== undefined) {
+				example[name] = property.default;
+			} else if (property.enum) {
+				example[name] = property.enum[0];
+			} else if (property.type == "integer") {
+				example[name] = 0;
+			} else if (property.type == "boolean") {
+				example[name] = false;
+			} else if (property.type == "array") {
+				example[name] = [];
+			} else {
+				example[name] = "";
+			}
+		}
+		return JSON.stringify(example, null, "\t");
+	}
+
+	function addField(form, labelText, name, input) {
+		var div = element("div");
+		div.appendChild(element("label", labelText + ":"));
+		input.name = name;
+		div.appendChild(input);
+		form.appendChild(div);
+	}
+
+	function operationForm(doc, path, method, op) {
+		var section = element("div", "", "api-operation");
+		section.appendChild(element("h3", method.toUpperCase() + " " + path));
+		section.appendChild(element("p", op.summary));
+		if (op.description) {
+			section.appendChild(element("p", op.description));
+		}
+
+		var form = element("form");
+		form.noValidate = true;
+		var params = op.parameters || [];
+		for (var i = 0; i < params.length; i++) {
+			var input = element("input");
+			input.type = "text";
+			addField(form, params[i].name + " (" + params[i].in + ")", "param-" + params[i].name, input);
+		}
+		if (op.requestBody) {
+			var body = element("textarea");
+			body.value = exampleBody(schemaFor(doc, op.requestBody.content["application/json"].schema.$ref));
+			addField(form, "Body", "body", body);
+		}
+		var submit = element("input");
+		submit.type = "submit";
+		submit.value = "Send";
+		var div = element("div");
+		div.appendChild(submit);
+		form.appendChild(div);
+
+		var output = element("pre", "", "api-response");
+		form.addEventListener("submit", function (event) {
+			event.preventDefault();
+			send(path, method, params, form, output);
+		});
+
+		section.appendChild(form);
+		section.appendChild(output);
+		return section;
+	}
+
+	function send(path, method, params, form, output) {
+		var url = path;
+		var query = new URLSearchParams();
+		for (var i = 0; i < params.length; i++) {
+			var value = form.elements["param-" + params[i].name].value;
+			if (params[i].in == "path") {
+				url = url.replace("{" + params[i].name + "}", encodeURIComponent(value));
+			} else if (value != "") {
+				query.set(params[i].name, value);
+			}
+		}
+		if (query.toString() != "") {
+			url += "?" + query.toString();
+		}
+
+		var options = {method: method.toUpperCase(), headers: {}, credentials: "omit"};
+		if (tokenInput.value != "") {
+			options.headers["Authorization"] = "Bearer " + tokenInput.value;
+		}
+		if (form.elements["body"]) {
+			options.headers["Content-Type"] = "application/json";
+			options.body = form.elements["body"].value;
+		}
+
+		output.textContent = "Sending...";
+		fetch(url, options).then(function (response) {
+			return response.text().then(function (text) {
+				output.textContent = response.status + " " + response.statusText + "\n\n" + text;
+			});
+		}).catch(function (err) {
+			output.textContent = "Request failed: " + err;
+		});
+	}
+
+	fetch("/api/openapi.json").then(function (response) {
+		return response.json();
+	}).then(function (doc) {
+		container.textContent = "";
+		var paths = Object.keys(doc.paths).sort();
+		for (var i = 0; i < paths.length; i++) {
+			var methods = Object.keys(doc.paths[paths[i]]).sort();
+			for (var j = 0; j < methods.length; j++) {
+				container.appendChild(operationForm(doc, paths[i], methods[j], doc.paths[paths[i]][methods[j]]));
+			}
+		}
+	}).catch(function (err) {
+		container.textContent = "Could not load the API description: " + err;
+	});
+})();
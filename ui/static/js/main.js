@@ -5,4 +5,49 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// solve the proof-of-work challenges of forms in the background. the answer
+// is a nonce such that SHA-256(challenge + ":" + nonce) starts with as many
+// zero bits as the challenge asks for.
+function leadingZeroBits(bytes) {
+	var n = 0;
+	for (var i = 0; i < bytes.length; i++) {
+		if (bytes[i] == 0) {
+			n += 8;
+			continue;
+		}
+		return n + Math.clz32(bytes[i]) - 24;
+	}
+	return n;
+}
+
+async function solveChallenge(challenge) {
+	var difficulty = parseInt(challenge.split(".")[0], 10);
+	var encoder = new TextEncoder();
+	for (var nonce = 0; ; nonce++) {
+		var hash = await crypto.subtle.digest("SHA-256", encoder.encode(challenge + ":" + nonce));
+		if (leadingZeroBits(new Uint8Array(hash)) >= difficulty) {
+			return String(nonce);
+		}
+	}
+}
+
+var challengeInputs = document.querySelectorAll("input[name='pow_challenge']");
+for (var i = 0; i < challengeInputs.length; i++) {
+	(function (form, challenge) {
+		var nonceInput = form.querySelector("input[name='pow_nonce']");
+		var solved = solveChallenge(challenge).then(function (nonce) {
+			nonceInput.value = nonce;
+		});
+		// wait for the answer if the form is sent before it is found
+		form.addEventListener("submit", function (event) {
+			if (nonceInput.value == "") {
+				event.preventDefault();
+				solved.then(function () {
+					form.submit();
+				});
+			}
+		});
+	})(challengeInputs[i].form, challengeInputs[i].value);
+}